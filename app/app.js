@@ -11,6 +11,15 @@ document.addEventListener('DOMContentLoaded', async () => {
   }
 });
 
+document.getElementById('video-search-form').addEventListener('submit', async (event) => {
+  event.preventDefault();
+  await getVideos();
+});
+
+document.getElementById('video-sort').addEventListener('change', async () => {
+  await getVideos();
+});
+
 document.getElementById('video-draft-form').addEventListener('submit', async (event) => {
   event.preventDefault();
   await createVideoDraft();
@@ -24,6 +33,12 @@ document.getElementById('login-form').addEventListener('submit', async (event) =
 async function createVideoDraft() {
   const title = document.getElementById('video-title').value;
   const description = document.getElementById('video-description').value;
+  const tags = document
+    .getElementById('video-tags')
+    .value.split(',')
+    .map((tag) => tag.trim())
+    .filter((tag) => tag);
+  const is_public = document.getElementById('video-public').checked;
 
   try {
     const res = await fetch('/api/videos', {
@@ -32,7 +47,7 @@ async function createVideoDraft() {
         'Content-Type': 'application/json',
         Authorization: `Bearer ${localStorage.getItem('token')}`,
       },
-      body: JSON.stringify({ title, description }),
+      body: JSON.stringify({ title, description, tags, is_public }),
     });
     const data = await res.json();
     if (!res.ok) {
@@ -152,23 +167,62 @@ async function uploadThumbnail(videoID) {
   setUploadButtonState(false, uploadBtnSelector);
 }
 
+const UPLOAD_CHUNK_SIZE = 8 * 1024 * 1024;
+const UPLOAD_MAX_RETRIES = 5;
+
 async function uploadVideoFile(videoID) {
   const videoFile = document.getElementById('video-file').files[0];
   if (!videoFile) return;
 
-  const formData = new FormData();
-  formData.append('video', videoFile);
-
   uploadBtnSelector = 'upload-video-btn';
   setUploadButtonState(true, uploadBtnSelector);
+  const progressEvents = await watchVideoProgress(videoID);
 
   try {
-    const res = await fetch(`/api/video_upload/${videoID}`, {
+    if (await uploadVideoDirect(videoID, videoFile)) {
+      // the server processes direct uploads in the background
+      await progressEvents.done;
+      console.log('Video uploaded!');
+      await getVideo(videoID);
+      progressEvents.close();
+      setUploadButtonState(false, uploadBtnSelector);
+      return;
+    }
+
+    const sessionRes = await fetch(`/api/video_upload/${videoID}/sessions`, {
+      method: 'POST',
+      headers: {
+        Authorization: `Bearer ${localStorage.getItem('token')}`,
+        'Upload-Length': String(videoFile.size),
+      },
+    });
+    const session = await sessionRes.json();
+    if (!sessionRes.ok) {
+      throw new Error(`Failed to start upload. Error: ${session.error}`);
+    }
+    const uploadURL = sessionRes.headers.get('Location');
+
+    let offset = 0;
+    let retries = 0;
+    while (offset < videoFile.size) {
+      try {
+        offset = await uploadVideoChunk(uploadURL, videoFile, offset);
+        retries = 0;
+      } catch (error) {
+        if (++retries > UPLOAD_MAX_RETRIES) {
+          throw error;
+        }
+        // wait a bit, then ask the server how much it actually received
+        await new Promise((resolve) => setTimeout(resolve, 1000 * retries));
+        offset = await getUploadOffset(uploadURL);
+      }
+    }
+
+    const res = await fetch(`${uploadURL}/complete`, {
       method: 'POST',
       headers: {
         Authorization: `Bearer ${localStorage.getItem('token')}`,
       },
-      body: formData,
     });
     if (!res.ok) {
       const data = await res.json();
@@ -181,14 +235,162 @@ async function uploadVideoFile(videoID) {
     alert(`Error: ${error.message}`);
   }
 
+  progressEvents.close();
   setUploadButtonState(false, uploadBtnSelector);
 }
 
+// watchVideoProgress shows the server's progress events for the video until
+// it's closed. Its done promise resolves once the video is ready or failed.
+// EventSource can't send headers, so it connects with a short-lived events
+// token instead of the access token.
+async function watchVideoProgress(videoID) {
+  const progressText = document.getElementById('upload-progress');
+  progressText.textContent = '';
+  const tokenRes = await fetch(`/api/videos/${videoID}/events/token`, {
+    method: 'POST',
+    headers: {
+      Authorization: `Bearer ${localStorage.getItem('token')}`,
+    },
+  });
+  if (!tokenRes.ok) {
+    // the upload works without progress, it just isn't shown
+    return { close() {}, done: Promise.resolve() };
+  }
+  const { token } = await tokenRes.json();
+  const events = new EventSource(`/api/videos/${videoID}/events?token=${encodeURIComponent(token)}`);
+  let finished;
+  const done = new Promise((resolve) => {
+    finished = resolve;
+  });
+  events.addEventListener('progress', (message) => {
+    const event = JSON.parse(message.data);
+    const percent = event.bytes_total ? ` ${Math.floor((100 * (event.bytes_done || 0)) / event.bytes_total)}%` : '';
+    switch (event.stage) {
+      case 'receiving':
+        progressText.textContent = `Uploading${percent}`;
+        break;
+      case 'processing':
+        progressText.textContent = event.step ? `Processing (${event.step})` : 'Processing';
+        break;
+      case 'storing':
+        progressText.textContent = `Saving${percent}`;
+        break;
+      case 'ready':
+        progressText.textContent = 'Ready';
+        finished();
+        break;
+      case 'failed':
+        progressText.textContent = `Failed: ${event.error}`;
+        finished();
+        break;
+    }
+  });
+  return {
+    close() {
+      events.close();
+      finished();
+    },
+    done,
+  };
+}
+
+// uploadVideoDirect posts the file straight to the bucket with a presigned
+// POST policy. It returns false if the server doesn't support direct uploads.
+async function uploadVideoDirect(videoID, videoFile) {
+  const presignRes = await fetch(`/api/video_upload/${videoID}/presign`, {
+    method: 'POST',
+    headers: {
+      Authorization: `Bearer ${localStorage.getItem('token')}`,
+    },
+  });
+  if (presignRes.status === 501) {
+    return false;
+  }
+  const presigned = await presignRes.json();
+  if (!presignRes.ok) {
+    throw new Error(`Failed to start upload. Error: ${presigned.error}`);
+  }
+
+  const formData = new FormData();
+  for (const [name, value] of Object.entries(presigned.fields)) {
+    formData.append(name, value);
+  }
+  // the file has to be the last field of the form
+  formData.append('file', videoFile);
+
+  const uploadRes = await fetch(presigned.url, {
+    method: 'POST',
+    body: formData,
+  });
+  if (!uploadRes.ok) {
+    throw new Error(`Failed to upload video to storage (status ${uploadRes.status})`);
+  }
+
+  const res = await fetch(`/api/video_upload/${videoID}/complete`, {
+    method: 'POST',
+    headers: {
+      'Content-Type': 'application/json',
+      Authorization: `Bearer ${localStorage.getItem('token')}`,
+    },
+    body: JSON.stringify({ key: presigned.key }),
+  });
+  if (!res.ok) {
+    const data = await res.json();
+    throw new Error(`Failed to upload video file. Error: ${data.error}`);
+  }
+  return true;
+}
+
+async function uploadVideoChunk(uploadURL, file, offset) {
+  const chunk = file.slice(offset, offset + UPLOAD_CHUNK_SIZE);
+  const res = await fetch(uploadURL, {
+    method: 'PATCH',
+    headers: {
+      Authorization: `Bearer ${localStorage.getItem('token')}`,
+      'Content-Type': 'application/offset+octet-stream',
+      'Upload-Offset': String(offset),
+    },
+    body: chunk,
+  });
+  if (!res.ok) {
+    throw new Error(`Failed to upload chunk at offset ${offset}`);
+  }
+  return Number(res.headers.get('Upload-Offset'));
+}
+
+async function getUploadOffset(uploadURL) {
+  const res = await fetch(uploadURL, {
+    method: 'HEAD',
+    headers: {
+      Authorization: `Bearer ${localStorage.getItem('token')}`,
+    },
+  });
+  if (!res.ok) {
+    throw new Error('Failed to get upload offset.');
+  }
+  return Number(res.headers.get('Upload-Offset'));
+}
+
 const videoStateHandler = createVideoStateHandler();
 
-async function getVideos() {
+let nextVideosCursor = null;
+
+// getVideos loads the first page of videos, or the next one when more is true.
+async function getVideos(more = false) {
   try {
-    const res = await fetch('/api/videos', {
+    const params = new URLSearchParams();
+    const query = document.getElementById('video-search').value.trim();
+    if (query) {
+      params.set('q', query);
+    }
+    const [sort, order] = document.getElementById('video-sort').value.split(':');
+    params.set('sort', sort);
+    params.set('order', order);
+    if (more && nextVideosCursor) {
+      params.set('cursor', nextVideosCursor);
+    }
+
+    const res = await fetch(`/api/videos?${params}`, {
       method: 'GET',
       headers: {
         Authorization: `Bearer ${localStorage.getItem('token')}`,
@@ -199,15 +401,66 @@ async function getVideos() {
       throw new Error(`Failed to get videos. Error: ${data.error}`);
     }
 
-    const videos = await res.json();
+    const page = await res.json();
+    nextVideosCursor = page.next_cursor;
     const videoList = document.getElementById('video-list');
-    videoList.innerHTML = '';
-    for (const video of videos) {
+    if (!more) {
+      videoList.innerHTML = '';
+    }
+    for (const video of page.videos) {
       const listItem = document.createElement('li');
-      listItem.textContent = video.title;
+      listItem.textContent = `${video.title} (${video.status})`;
       listItem.onclick = () => videoStateHandler(video.id);
       videoList.appendChild(listItem);
     }
+    document.getElementById('load-more-videos').style.display = nextVideosCursor ? 'inline-block' : 'none';
+    if (!more) {
+      await getTrash();
+    }
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+}
+
+async function getTrash() {
+  const res = await fetch('/api/videos/trash', {
+    method: 'GET',
+    headers: {
+      Authorization: `Bearer ${localStorage.getItem('token')}`,
+    },
+  });
+  if (!res.ok) {
+    const data = await res.json();
+    throw new Error(`Failed to get trash. Error: ${data.error}`);
+  }
+
+  const videos = await res.json();
+  const trashList = document.getElementById('trash-list');
+  trashList.innerHTML = '';
+  for (const video of videos) {
+    const listItem = document.createElement('li');
+    listItem.textContent = `${video.title} `;
+    const restoreButton = document.createElement('button');
+    restoreButton.textContent = 'Restore';
+    restoreButton.onclick = () => restoreVideo(video.id);
+    listItem.appendChild(restoreButton);
+    trashList.appendChild(listItem);
+  }
+}
+
+async function restoreVideo(videoID) {
+  try {
+    const res = await fetch(`/api/videos/${videoID}/restore`, {
+      method: 'POST',
+      headers: {
+        Authorization: `Bearer ${localStorage.getItem('token')}`,
+      },
+    });
+    if (!res.ok) {
+      const data = await res.json();
+      throw new Error(`Failed to restore video. Error: ${data.error}`);
+    }
+    await getVideos();
   } catch (error) {
     alert(`Error: ${error.message}`);
   }
@@ -242,6 +495,7 @@ async function getVideo(videoID) {
     }
 
     const video = await res.json();
+    currentVideoETag = res.headers.get('ETag');
     viewVideo(video);
   } catch (error) {
     alert(`Error: ${error.message}`);
@@ -249,12 +503,53 @@ async function getVideo(videoID) {
 }
 
 let currentVideo = null;
+let currentVideoETag = null;
+
+async function updateVideoMetadata() {
+  const title = document.getElementById('edit-video-title').value;
+  const description = document.getElementById('edit-video-description').value;
+
+  try {
+    const headers = {
+      'Content-Type': 'application/merge-patch+json',
+      Authorization: `Bearer ${localStorage.getItem('token')}`,
+    };
+    if (currentVideoETag) {
+      headers['If-Match'] = currentVideoETag;
+    }
+    const res = await fetch(`/api/videos/${currentVideo.id}`, {
+      method: 'PATCH',
+      headers,
+      body: JSON.stringify({ title, description }),
+    });
+    const data = await res.json();
+    if (res.status === 412) {
+      alert('This video was changed somewhere else, reloading it.');
+      await getVideo(currentVideo.id);
+      return;
+    }
+    if (!res.ok) {
+      throw new Error(`Failed to update video. Error: ${data.error}`);
+    }
+
+    currentVideoETag = res.headers.get('ETag');
+    viewVideo(data);
+    await getVideos();
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+}
 
 function viewVideo(video) {
   currentVideo = video;
   document.getElementById('video-display').style.display = 'block';
   document.getElementById('video-title-display').textContent = video.title;
   document.getElementById('video-description-display').textContent = video.description;
+  document.getElementById('edit-video-title').value = video.title;
+  document.getElementById('edit-video-description').value = video.description;
+  document.getElementById('video-status-display').textContent = video.failure_reason
+    ? `Status: ${video.status} (${video.failure_reason})`
+    : `Status: ${video.status}`;
 
   const thumbnailImg = document.getElementById('thumbnail-image');
   if (!video.thumbnail_url) {
@@ -262,6 +557,16 @@ function viewVideo(video) {
   } else {
     thumbnailImg.style.display = 'block';
     thumbnailImg.src = video.thumbnail_url;
+    const renditions = (video.thumbnail_renditions || []).filter(
+      (rendition) => rendition.content_type === 'image/jpeg',
+    );
+    if (renditions.length > 0) {
+      thumbnailImg.srcset = renditions.map((rendition) => `${rendition.url} ${rendition.width}w`).join(', ');
+      thumbnailImg.sizes = '(max-width: 640px) 100vw, 640px';
+    } else {
+      thumbnailImg.removeAttribute('srcset');
+      thumbnailImg.removeAttribute('sizes');
+    }
   }
 
   const videoPlayer = document.getElementById('video-player');
@@ -270,7 +575,9 @@ function viewVideo(video) {
       videoPlayer.style.display = 'none';
     } else {
       videoPlayer.style.display = 'block';
-      videoPlayer.src = video.video_url;
+      // browsers with native HLS support get the adaptive stream once it's ready
+      const canPlayHLS = videoPlayer.canPlayType('application/vnd.apple.mpegurl') !== '';
+      videoPlayer.src = video.hls_manifest_url && canPlayHLS ? video.hls_manifest_url : video.video_url;
       videoPlayer.load();
     }
   }
@@ -292,7 +599,7 @@ async function deleteVideo() {
     if (!res.ok) {
       throw new Error('Failed to delete video.');
     }
-    alert('Video deleted successfully.');
+    alert('Video moved to the trash.');
     document.getElementById('video-display').style.display = 'none';
     await getVideos();
   } catch (error) {
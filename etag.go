@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// errVideoChanged is returned when a request's If-Match header doesn't
+// match the video anymore.
+var errVideoChanged = errors.New("video has changed since it was read")
+
+// videoETag identifies the current state of a video. It changes whenever
+// the video's version does.
+func videoETag(video database.Video) string {
+	return `"` + strconv.FormatInt(video.Version, 10) + `"`
+}
+
+// checkIfMatch returns errVideoChanged unless the request's If-Match header
+// allows changing video. It's also called from ModifyVideo changes, so a
+// video changed by another request in the meantime fails the precondition
+// instead of being merged.
+func checkIfMatch(r *http.Request, video database.Video) error {
+	if !ifMatch(r, videoETag(video)) {
+		return errVideoChanged
+	}
+	return nil
+}
+
+// requireIfMatch checks the request's If-Match header against video and
+// responds with 412 Precondition Failed if it doesn't match.
+func requireIfMatch(w http.ResponseWriter, r *http.Request, video database.Video) bool {
+	return !respondWithVideoChanged(w, checkIfMatch(r, video))
+}
+
+// respondWithVideoChanged responds with 412 Precondition Failed if err
+// means the video was changed by another request. It reports whether it
+// responded.
+func respondWithVideoChanged(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, errVideoChanged) && !errors.Is(err, database.ErrVersionConflict) {
+		return false
+	}
+	respondWithError(w, http.StatusPreconditionFailed, "Video has changed since it was read", err)
+	return true
+}
+
+// ifMatch reports whether the request's If-Match header allows changing a
+// resource whose current ETag is etag. Requests without the header always
+// go through.
+func ifMatch(r *http.Request, etag string) bool {
+	values := r.Header.Values("If-Match")
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		for _, candidate := range strings.Split(value, ",") {
+			//weak tags never match, If-Match uses the strong comparison
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+	}
+	return false
+}
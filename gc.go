@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// managedPrefixes are the parts of the store the app writes to. Garbage
+// collection never looks outside of them.
+var managedPrefixes = []string{"landscape/", "portrait/", "other/", "direct/", "thumbnails/", "hls/"}
+
+// gcGracePeriod keeps garbage collection away from objects that may belong
+// to an upload still in progress.
+const gcGracePeriod = time.Hour
+
+// runGC implements the gc command: it reports objects in the store and
+// files in the assets directory that no video references, and removes them
+// with -delete.
+func runGC(cfg *apiConfig, args []string) error {
+	flags := flag.NewFlagSet("gc", flag.ContinueOnError)
+	remove := flags.Bool("delete", false, "remove the orphans instead of only listing them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return cfg.collectGarbage(context.Background(), *remove, os.Stdout)
+}
+
+func (cfg *apiConfig) collectGarbage(ctx context.Context, remove bool, out io.Writer) error {
+	refs, err := cfg.db.GetAllMediaRefs(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get media references: %w", err)
+	}
+
+	keys := map[string]bool{}
+	hlsDirs := []string{}
+	assetPaths := map[string]bool{}
+	for _, ref := range refs {
+		if key, ok := cfg.mediaKey(ref.Ref); ok {
+			keys[key] = true
+			if ref.Kind == database.MediaHLS {
+				hlsDirs = append(hlsDirs, path.Dir(key)+"/")
+			}
+		} else if assetPath, ok := cfg.legacyAssetPath(ref.Ref); ok {
+			assetPaths[assetPath] = true
+		}
+	}
+	referenced := func(key string) bool {
+		if keys[key] {
+			return true
+		}
+		for _, dir := range hlsDirs {
+			if strings.HasPrefix(key, dir) {
+				return true
+			}
+		}
+		return false
+	}
+
+	cutoff := time.Now().Add(-gcGracePeriod)
+	var orphans, orphanBytes int64
+
+	for _, prefix := range managedPrefixes {
+		objects, err := cfg.store.List(ctx, prefix)
+		if err != nil {
+			return fmt.Errorf("couldn't list %s: %w", prefix, err)
+		}
+		for _, object := range objects {
+			if referenced(object.Key) || object.LastModified.After(cutoff) {
+				continue
+			}
+			orphans++
+			orphanBytes += object.Size
+			fmt.Fprintf(out, "orphaned object %s (%d bytes)\n", object.Key, object.Size)
+			if remove {
+				if err := cfg.store.Delete(ctx, object.Key); err != nil {
+					return fmt.Errorf("couldn't delete %s: %w", object.Key, err)
+				}
+			}
+		}
+	}
+
+	//thumbnails saved before the object store, the managed prefixes are covered above
+	err = filepath.WalkDir(cfg.assetsRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(cfg.assetsRoot, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if d.IsDir() {
+			for _, prefix := range managedPrefixes {
+				if key+"/" == prefix {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if assetPaths[p] || keys[key] || info.ModTime().After(cutoff) {
+			return nil
+		}
+		orphans++
+		orphanBytes += info.Size()
+		fmt.Fprintf(out, "orphaned asset %s (%d bytes)\n", p, info.Size())
+		if remove {
+			return os.Remove(p)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't scan assets directory: %w", err)
+	}
+
+	action := "found"
+	if remove {
+		action = "deleted"
+	}
+	fmt.Fprintf(out, "%s %d orphans, %d bytes\n", action, orphans, orphanBytes)
+	return nil
+}
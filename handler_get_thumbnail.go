@@ -1,32 +1,78 @@
 package main
 
 import (
-	"fmt"
+	"bytes"
+	"errors"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
-	"github.com/google/uuid"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
 )
 
+// maxThumbnailSize caps how much of a stored thumbnail gets buffered for a
+// response. Larger ones are streamed instead.
+const maxThumbnailSize = 10 << 20
+
 func (cfg *apiConfig) handlerThumbnailGet(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+	video, ok := cfg.getViewableVideoForRequest(w, r)
+	if !ok {
+		return
+	}
+	if video.ThumbnailURL == nil {
+		respondWithError(w, http.StatusNotFound, "Thumbnail not found", nil)
 		return
 	}
 
-	tn, ok := videoThumbnails[videoID]
+	key, ok := cfg.mediaKey(*video.ThumbnailURL)
 	if !ok {
-		respondWithError(w, http.StatusNotFound, "Thumbnail not found", nil)
+		//thumbnail lives outside of the object store
+		http.Redirect(w, r, *video.ThumbnailURL, http.StatusFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", tn.mediaType)
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(tn.data)))
+	body, info, err := cfg.store.Get(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Thumbnail not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get thumbnail", err)
+		return
+	}
+	defer body.Close()
 
-	_, err = w.Write(tn.data)
+	data, err := io.ReadAll(io.LimitReader(body, maxThumbnailSize+1))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error writing response", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read thumbnail", err)
 		return
 	}
+
+	etag := info.ETag
+	if etag != "" && !strings.HasPrefix(etag, `"`) {
+		etag = `"` + etag + `"`
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if len(data) > maxThumbnailSize {
+		//too big to buffer, stream it whole without ranges or conditionals
+		if info.Size > 0 {
+			w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		}
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodHead {
+			return
+		}
+		if _, err := io.Copy(w, io.MultiReader(bytes.NewReader(data), body)); err != nil {
+			log.Printf("couldn't stream thumbnail %s: %v", key, err)
+		}
+		return
+	}
+
+	//ServeContent takes care of If-None-Match, If-Modified-Since, ranges and HEAD
+	http.ServeContent(w, r, key, info.LastModified, bytes.NewReader(data))
 }
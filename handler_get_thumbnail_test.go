@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestThumbnailGet(t *testing.T) {
+	cfg, user := newTestConfig(t)
+	ctx := context.Background()
+
+	for name, size := range map[string]int{"buffered": 1 << 10, "streamed": maxThumbnailSize + 1<<10} {
+		t.Run(name, func(t *testing.T) {
+			data := bytes.Repeat([]byte{0xff}, size)
+			key := "thumbnails/" + name + ".png"
+			if err := cfg.store.Put(ctx, key, bytes.NewReader(data), "image/png"); err != nil {
+				t.Fatal(err)
+			}
+			video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: name, UserID: user.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			thumbnailURL := cfg.store.URL(key)
+			if _, err := cfg.db.ModifyVideo(ctx, video.ID, func(v *database.Video) error {
+				v.ThumbnailURL = &thumbnailURL
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/thumbnails/"+video.ID.String(), nil)
+			req.SetPathValue("videoID", video.ID.String())
+			authorize(t, cfg, req, user)
+			rec := httptest.NewRecorder()
+			cfg.handlerThumbnailGet(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			if !bytes.Equal(rec.Body.Bytes(), data) {
+				t.Errorf("got %d bytes, want the whole %d byte thumbnail", rec.Body.Len(), size)
+			}
+			if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(size) {
+				t.Errorf("Content-Length = %q, want %d", got, size)
+			}
+			if rec.Header().Get("Content-Type") != "image/png" {
+				t.Errorf("Content-Type = %q", rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
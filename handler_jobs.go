@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerJobsList(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	status := database.JobStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", database.JobStatusQueued, database.JobStatusRunning, database.JobStatusSucceeded, database.JobStatusDead:
+	default:
+		respondWithError(w, http.StatusBadRequest, "Invalid job status", nil)
+		return
+	}
+
+	jobs, err := cfg.db.GetJobsForUser(r.Context(), userID, status)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve jobs", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, jobs)
+}
+
+func (cfg *apiConfig) handlerJobGet(w http.ResponseWriter, r *http.Request) {
+	job, ok := cfg.getOwnedJobForRequest(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+// handlerJobRetry requeues a dead lettered job.
+func (cfg *apiConfig) handlerJobRetry(w http.ResponseWriter, r *http.Request) {
+	job, ok := cfg.getOwnedJobForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	requeued, err := cfg.db.RequeueDeadJob(r.Context(), job.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't requeue job", err)
+		return
+	}
+	if !requeued {
+		respondWithError(w, http.StatusConflict, "Only dead jobs can be retried", nil)
+		return
+	}
+
+	job, err = cfg.db.GetJob(r.Context(), job.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get job", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+func (cfg *apiConfig) getOwnedJobForRequest(w http.ResponseWriter, r *http.Request) (database.Job, bool) {
+	jobID, err := uuid.Parse(r.PathValue("jobID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid job ID", err)
+		return database.Job{}, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Job{}, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.Job{}, false
+	}
+
+	job, err := cfg.db.GetJob(r.Context(), jobID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Job not found", err)
+		return database.Job{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get job", err)
+		return database.Job{}, false
+	}
+	//jobs of other users are reported as missing
+	if job.UserID == nil || *job.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Job not found", nil)
+		return database.Job{}, false
+	}
+	return job, true
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// handlerObjectGet serves objects straight out of the configured store, for
+// backends (like the in-memory one) that have no public URL of their own.
+func (cfg *apiConfig) handlerObjectGet() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, info, err := cfg.store.Get(r.Context(), r.URL.Path)
+		if errors.Is(err, storage.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Object not found", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get object", err)
+			return
+		}
+		defer body.Close()
+
+		w.Header().Set("Content-Type", info.ContentType)
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		io.Copy(w, body)
+	})
+}
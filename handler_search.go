@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// highlightMarkers turns the database's highlight markers into HTML.
+var highlightMarkers = strings.NewReplacer(
+	database.HighlightStart, "<mark>",
+	database.HighlightEnd, "</mark>",
+)
+
+// handlerSearch ranks the user's videos, or everyone's public videos with
+// scope=public, by how well they match q.
+func (cfg *apiConfig) handlerSearch(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Results    []database.SearchResult `json:"results"`
+		NextOffset *int                    `json:"next_offset"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	query := r.URL.Query()
+	params := database.SearchVideosParams{
+		UserID: userID,
+		Scope:  database.SearchScope(query.Get("scope")),
+		Query:  query.Get("q"),
+		Limit:  database.DefaultSearchPageSize,
+	}
+	if strings.TrimSpace(params.Query) == "" {
+		respondWithError(w, http.StatusBadRequest, "q is required", nil)
+		return
+	}
+	switch params.Scope {
+	case "":
+		params.Scope = database.SearchScopeMine
+	case database.SearchScopeMine, database.SearchScopePublic:
+	default:
+		respondWithError(w, http.StatusBadRequest, "scope must be mine or public", nil)
+		return
+	}
+	if limit := query.Get("limit"); limit != "" {
+		params.Limit, err = strconv.Atoi(limit)
+		if err != nil || params.Limit < 1 || params.Limit > database.MaxSearchPageSize {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", database.MaxSearchPageSize), err)
+			return
+		}
+	}
+	if offset := query.Get("offset"); offset != "" {
+		params.Offset, err = strconv.Atoi(offset)
+		if err != nil || params.Offset < 0 {
+			respondWithError(w, http.StatusBadRequest, "offset must be a positive number", err)
+			return
+		}
+	}
+
+	page, err := cfg.db.SearchVideos(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search videos", err)
+		return
+	}
+
+	for i, result := range page.Results {
+		result.Video, err = cfg.dbVideoToSignedVideo(r.Context(), result.Video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URLs", err)
+			return
+		}
+		//escaping the text, only the highlights are markup
+		result.TitleHighlight = highlightMarkers.Replace(html.EscapeString(result.TitleHighlight))
+		result.DescriptionSnippet = highlightMarkers.Replace(html.EscapeString(result.DescriptionSnippet))
+		page.Results[i] = result
+	}
+
+	//the offset is null on the last page
+	var nextOffset *int
+	if page.NextOffset > 0 {
+		nextOffset = &page.NextOffset
+	}
+	respondWithJSON(w, http.StatusOK, response{
+		Results:    page.Results,
+		NextOffset: nextOffset,
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// handlerThumbnailRegenerate replaces the thumbnail with the frame at the
+// "at" query parameter (in seconds) of the stored video.
+func (cfg *apiConfig) handlerThumbnailRegenerate(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideoForRequest(w, r)
+	if !ok {
+		return
+	}
+	if !requireIfMatch(w, r, video) {
+		return
+	}
+
+	at, err := strconv.ParseFloat(r.URL.Query().Get("at"), 64)
+	if err != nil || at < 0 {
+		respondWithError(w, http.StatusBadRequest, "at must be a timestamp in seconds", err)
+		return
+	}
+	if video.Duration != nil && *video.Duration > 0 && at >= *video.Duration {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("at must be less than the video duration of %.2fs", *video.Duration), nil)
+		return
+	}
+
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusConflict, "Video hasn't been uploaded yet", nil)
+		return
+	}
+	key, ok := cfg.mediaKey(*video.VideoURL)
+	if !ok {
+		respondWithError(w, http.StatusConflict, "Video isn't in the object store", nil)
+		return
+	}
+
+	//downloading the video to a temp file for ffmpeg
+	body, _, err := cfg.store.Get(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusConflict, "Video file is missing from the object store", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video file", err)
+		return
+	}
+	defer body.Close()
+
+	f, err := os.CreateTemp("", "tubely-thumbnail-*.mp4")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create temp file", err)
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	_, err = io.Copy(f, body)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't download video file", err)
+		return
+	}
+
+	frame, err := media.ExtractFrame(r.Context(), f.Name(), time.Duration(at*float64(time.Second)))
+	if err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, fmt.Sprintf("Couldn't extract frame: %v", err), err)
+		return
+	}
+
+	//a frame the user picked counts as their own thumbnail
+	thumbnailRef, renditions, err := cfg.putThumbnail(r.Context(), "thumbnails/", frame)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store thumbnail", err)
+		return
+	}
+
+	video, err = cfg.db.ModifyVideo(r.Context(), video.ID, func(video *database.Video) error {
+		if err := checkIfMatch(r, *video); err != nil {
+			return err
+		}
+		video.ThumbnailURL = &thumbnailRef
+		video.ThumbnailRenditions = renditions
+		return nil
+	})
+	if err != nil {
+		//nothing references the new renditions
+		cfg.discardMedia(r.Context(), thumbnailRefs(renditions))
+	}
+	if respondWithVideoChanged(w, err) {
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update thumbnail url", err)
+		return
+	}
+
+	signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video urls", err)
+		return
+	}
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, signedVideo)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// trashPurgeInterval is how often videos past the retention period are
+// deleted for good.
+const trashPurgeInterval = time.Hour
+
+func (cfg *apiConfig) handlerVideosTrashRetrieve(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	videos, err := cfg.db.GetTrashedVideos(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve trash", err)
+		return
+	}
+
+	signedVideos, err := cfg.dbVideosToSignedVideos(r.Context(), videos)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URLs", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, signedVideos)
+}
+
+func (cfg *apiConfig) handlerVideoRestore(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetTrashedVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video not found in trash", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Video not found in trash", nil)
+		return
+	}
+	if !requireIfMatch(w, r, video) {
+		return
+	}
+
+	err = cfg.db.RestoreVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video not found in trash", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't restore video", err)
+		return
+	}
+
+	video, err = cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video url", err)
+		return
+	}
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, signedVideo)
+}
+
+// runTrashPurge permanently deletes videos that have been in the trash for
+// longer than the retention period. Their media goes through the storage
+// deletion outbox.
+func (cfg *apiConfig) runTrashPurge(ctx context.Context) {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		purged, err := cfg.db.PurgeTrashedVideos(ctx, time.Now().Add(-cfg.trashRetention))
+		if err != nil {
+			log.Printf("couldn't purge trash: %v", err)
+		}
+		if purged > 0 {
+			log.Printf("purged %d videos from the trash", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/jobs"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validation"
+	"github.com/google/uuid"
+)
+
+// Direct uploads let the browser post the video straight to the bucket:
+// the presign endpoint hands out a POST policy for a key under
+// direct/<videoID>/, and the complete endpoint checks what actually landed
+// there and queues a job that processes it like any other upload.
+
+func directUploadPrefix(videoID uuid.UUID) string {
+	return "direct/" + videoID.String() + "/"
+}
+
+func (cfg *apiConfig) handlerUploadVideoPresign(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		storage.PresignedPost
+		Key       string    `json:"key"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	video, ok := cfg.getOwnedVideoForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	presigner, ok := cfg.store.(storage.PostPresigner)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "Direct uploads aren't supported by this storage backend", nil)
+		return
+	}
+	if !requireIfMatch(w, r, video) {
+		return
+	}
+
+	if !cfg.transitionVideo(w, r, &video, database.VideoStatusUploading) {
+		return
+	}
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	objectKey := directUploadPrefix(video.ID) + base64.RawURLEncoding.EncodeToString(key) + ".mp4"
+
+	post, err := presigner.PresignPost(r.Context(), objectKey, storage.PostPolicy{
+		KeyPrefix:   directUploadPrefix(video.ID),
+		ContentType: "video/mp4",
+		MinSize:     1,
+		MaxSize:     maxVideoUploadSize,
+		Expires:     cfg.presignExpiry,
+	})
+	if err != nil {
+		cfg.abandonUpload(r.Context(), video)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't presign upload", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		PresignedPost: post,
+		Key:           objectKey,
+		ExpiresAt:     time.Now().UTC().Add(cfg.presignExpiry),
+	})
+}
+
+func (cfg *apiConfig) handlerUploadVideoComplete(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Key string `json:"key"`
+	}
+
+	video, ok := cfg.getOwnedVideoForRequest(w, r)
+	if !ok {
+		return
+	}
+	if !requireIfMatch(w, r, video) {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !strings.HasPrefix(params.Key, directUploadPrefix(video.ID)) {
+		respondWithError(w, http.StatusBadRequest, "Key doesn't belong to this video", nil)
+		return
+	}
+
+	info, err := cfg.store.Head(r.Context(), params.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusConflict, "Video hasn't been uploaded yet", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check uploaded video", err)
+		return
+	}
+
+	//completing twice would process the same upload twice
+	if !cfg.transitionVideo(w, r, &video, database.VideoStatusProcessing) {
+		return
+	}
+
+	//the policy should have enforced these already, but don't trust what's in the bucket
+	_, err = cfg.checkStoredVideo(r.Context(), video.ID, params.Key, info)
+	if err != nil {
+		cfg.store.Delete(r.Context(), params.Key)
+		cfg.failVideo(r.Context(), video.ID, err)
+		respondWithVideoProcessingError(w, err)
+		return
+	}
+
+	//remuxing needs the whole file, so that happens in a job like other processing
+	_, err = jobs.Enqueue(r.Context(), cfg.db, jobTypeProcessDirectUpload, processDirectUploadPayload{
+		VideoID: video.ID,
+		Key:     params.Key,
+	}, &video.UserID)
+	if err != nil {
+		cfg.failVideo(r.Context(), video.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't queue video processing", err)
+		return
+	}
+
+	signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video url", err)
+		return
+	}
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusAccepted, signedVideo)
+}
+
+// checkStoredVideo validates and probes an object the client uploaded
+// directly. It only reads the object's boxes other than mdat, with ranged
+// reads, so a bad upload is rejected without downloading it.
+func (cfg *apiConfig) checkStoredVideo(ctx context.Context, videoID uuid.UUID, key string, info storage.ObjectInfo) (media.VideoInfo, error) {
+	if info.Size <= 0 || info.Size > maxVideoUploadSize {
+		return media.VideoInfo{}, &validation.Error{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    "file_too_large",
+			Message: fmt.Sprintf("Uploaded object is %d bytes, the limit is %d", info.Size, maxVideoUploadSize),
+		}
+	}
+	r := storage.ReaderAt(ctx, cfg.store, key, info.Size)
+
+	cfg.publishStep(videoID, "validating")
+	_, err := videoUploadRule.Validate(r, info.Size, info.ContentType)
+	if err != nil {
+		return media.VideoInfo{}, err
+	}
+
+	cfg.publishStep(videoID, "probing")
+	videoInfo, err := media.ProbeReader(ctx, r, info.Size)
+	if err != nil {
+		return media.VideoInfo{}, &processingError{reason: "couldn't read video metadata", err: err}
+	}
+	err = videoUploadRule.CheckDimensions(videoInfo.Width, videoInfo.Height)
+	if err != nil {
+		return media.VideoInfo{}, err
+	}
+	return videoInfo, nil
+}
+
+const jobTypeProcessDirectUpload = "process_direct_upload"
+
+type processDirectUploadPayload struct {
+	VideoID uuid.UUID `json:"video_id"`
+	Key     string    `json:"key"`
+}
+
+// handleProcessDirectUploadJob puts a completed direct upload through the
+// same processing as other uploads, which stores it under its final key,
+// and marks the video ready. The object under direct/ is deleted once it
+// isn't needed anymore.
+func (cfg *apiConfig) handleProcessDirectUploadJob(ctx context.Context, job database.Job) error {
+	var payload processDirectUploadPayload
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	uploaded := []database.MediaRef{{Ref: cfg.mediaRef(payload.Key), Kind: database.MediaObject}}
+
+	video, err := cfg.db.GetVideo(ctx, payload.VideoID)
+	if errors.Is(err, database.ErrNotFound) {
+		cfg.discardMedia(ctx, uploaded)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if video.Status != database.VideoStatusProcessing {
+		//processing was interrupted by a restart and the video failed, or it was deleted
+		cfg.discardMedia(ctx, uploaded)
+		return nil
+	}
+
+	workDir, err := os.MkdirTemp("", "tubely-direct-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	sourcePath := filepath.Join(workDir, "source.mp4")
+	err = cfg.downloadObject(ctx, payload.Key, sourcePath)
+	if err == nil {
+		var processed database.Video
+		processed, err = cfg.processVideoFile(ctx, video, sourcePath, "")
+		if err == nil {
+			_, err = cfg.markVideoReady(ctx, video, processed)
+		}
+	}
+
+	var validationErr *validation.Error
+	var procErr *processingError
+	switch {
+	case err == nil:
+		cfg.discardMedia(ctx, uploaded)
+		return nil
+	case errors.As(err, &validationErr), errors.As(err, &procErr):
+		cfg.discardMedia(ctx, uploaded)
+		cfg.failVideo(ctx, video.ID, err)
+		return jobs.Permanent(err)
+	}
+	if job.Attempts >= job.MaxAttempts {
+		cfg.discardMedia(ctx, uploaded)
+		cfg.failVideo(ctx, video.ID, err)
+	}
+	return err
+}
+
+// expireDirectUploads gives up on direct uploads that were presigned before
+// cutoff and never completed, deleting whatever was posted for them.
+func (cfg *apiConfig) expireDirectUploads(ctx context.Context, cutoff time.Time) {
+	videos, err := cfg.db.GetStaleUploadingVideos(ctx, cutoff)
+	if err != nil {
+		log.Printf("couldn't get stale uploading videos: %v", err)
+		return
+	}
+
+	for _, video := range videos {
+		cfg.abandonUpload(ctx, video)
+		objects, err := cfg.store.List(ctx, directUploadPrefix(video.ID))
+		if err != nil {
+			log.Printf("couldn't list direct uploads of video %s: %v", video.ID, err)
+			continue
+		}
+		refs := []database.MediaRef{}
+		for _, object := range objects {
+			refs = append(refs, database.MediaRef{Ref: cfg.mediaRef(object.Key), Kind: database.MediaObject})
+		}
+		cfg.discardMedia(ctx, refs)
+	}
+	if len(videos) > 0 {
+		log.Printf("expired %d unfinished direct uploads", len(videos))
+	}
+}
+
+// getOwnedVideoForRequest authenticates the request and loads the video named
+// in the path, which has to belong to the user. It writes the error response
+// itself.
+func (cfg *apiConfig) getOwnedVideoForRequest(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.Video{}, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Video{}, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.Video{}, false
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video not found", err)
+		return database.Video{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "Not authorized to update this video", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
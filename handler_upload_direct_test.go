@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validation"
+)
+
+func TestCheckStoredVideo(t *testing.T) {
+	cfg, user := newTestConfig(t)
+	ctx := context.Background()
+
+	//an mp4 header passes sniffing, the box structure is only checked by the
+	//upload rule and empty boxes only fail when probed
+	mp4Header := append([]byte{0, 0, 0, 0x18}, []byte("ftypmp42\x00\x00\x00\x00mp42isom")...)
+	emptyMP4 := append(append(mp4Header, 0, 0, 0, 8), "moov\x00\x00\x00\x08mdat"...)
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		size        int64
+		check       func(error) bool
+	}{
+		{"too large", mp4Header, "video/mp4", maxVideoUploadSize + 1, validationStatus(http.StatusUnprocessableEntity)},
+		{"not an mp4", bytes.Repeat([]byte("text "), 200), "video/mp4", 0, validationStatus(http.StatusUnsupportedMediaType)},
+		{"wrong declared type", append(mp4Header, make([]byte, 1000)...), "video/webm", 0, validationStatus(http.StatusUnsupportedMediaType)},
+		{"missing boxes", append(mp4Header, make([]byte, 1000)...), "video/mp4", 0, validationStatus(http.StatusUnprocessableEntity)},
+		{"unreadable mp4", emptyMP4, "video/mp4", 0, func(err error) bool {
+			var procErr *processingError
+			return errors.As(err, &procErr)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := directUploadPrefix(user.ID) + "upload.mp4"
+			if err := cfg.store.Put(ctx, key, bytes.NewReader(tt.data), tt.contentType); err != nil {
+				t.Fatal(err)
+			}
+			info, err := cfg.store.Head(ctx, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.size > 0 {
+				info.Size = tt.size
+			}
+
+			_, err = cfg.checkStoredVideo(ctx, user.ID, key, info)
+			if !tt.check(err) {
+				t.Errorf("checkStoredVideo = %v", err)
+			}
+		})
+	}
+}
+
+// newTestDirectUpload creates a video that's waiting for a direct upload and
+// puts data where the client would have posted it.
+func newTestDirectUpload(t *testing.T, cfg *apiConfig, user *database.User, data []byte) (database.Video, string) {
+	t.Helper()
+	ctx := context.Background()
+	video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "direct", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err = cfg.db.TransitionVideoStatus(ctx, video.ID, database.VideoStatusUploading, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := directUploadPrefix(video.ID) + "upload.mp4"
+	if err := cfg.store.Put(ctx, key, bytes.NewReader(data), "video/mp4"); err != nil {
+		t.Fatal(err)
+	}
+	return video, key
+}
+
+func TestUploadVideoCompleteIfMatch(t *testing.T) {
+	cfg, user := newTestConfig(t)
+	video, key := newTestDirectUpload(t, cfg, user, []byte("not checked"))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/video_upload/"+video.ID.String()+"/complete", strings.NewReader(`{"key":"`+key+`"}`))
+	req.SetPathValue("videoID", video.ID.String())
+	req.Header.Set("If-Match", `"stale"`)
+	authorize(t, cfg, req, user)
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideoComplete(rec, req)
+
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	got, err := cfg.db.GetVideo(context.Background(), video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != database.VideoStatusUploading {
+		t.Errorf("status = %s, want %s", got.Status, database.VideoStatusUploading)
+	}
+}
+
+func TestProcessDirectUploadJobSkipsFailedVideo(t *testing.T) {
+	cfg, user := newTestConfig(t)
+	ctx := context.Background()
+	video, key := newTestDirectUpload(t, cfg, user, []byte("upload"))
+	//the server restarted while the job was queued
+	if _, err := cfg.db.TransitionVideoStatus(ctx, video.ID, database.VideoStatusProcessing, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.db.FailInterruptedVideos(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := json.Marshal(processDirectUploadPayload{VideoID: video.ID, Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := database.Job{EnqueueJobParams: database.EnqueueJobParams{Payload: string(payload)}}
+	if err := cfg.handleProcessDirectUploadJob(ctx, job); err != nil {
+		t.Fatalf("handleProcessDirectUploadJob = %v", err)
+	}
+	if !slices.Equal(queuedDeletions(t, cfg), []string{cfg.mediaRef(key)}) {
+		t.Errorf("uploaded object wasn't queued for deletion")
+	}
+}
+
+func TestExpireDirectUploads(t *testing.T) {
+	cfg, user := newTestConfig(t)
+	ctx := context.Background()
+	video, key := newTestDirectUpload(t, cfg, user, []byte("upload"))
+	resumable := newTestUploadSession(t, cfg, user)
+
+	cfg.expireDirectUploads(ctx, time.Now().Add(-time.Hour))
+	if got := queuedDeletions(t, cfg); len(got) != 0 {
+		t.Fatalf("recent upload was expired: %v", got)
+	}
+
+	cfg.expireDirectUploads(ctx, time.Now().Add(time.Hour))
+	got, err := cfg.db.GetVideo(ctx, video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != database.VideoStatusDraft {
+		t.Errorf("status = %s, want %s", got.Status, database.VideoStatusDraft)
+	}
+	if !slices.Equal(queuedDeletions(t, cfg), []string{cfg.mediaRef(key)}) {
+		t.Errorf("uploaded object wasn't queued for deletion")
+	}
+
+	//resumable uploads expire with their session instead
+	got, err = cfg.db.GetVideo(ctx, resumable.VideoID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != database.VideoStatusUploading {
+		t.Errorf("video with an upload session is %s, want %s", got.Status, database.VideoStatusUploading)
+	}
+}
+
+func queuedDeletions(t *testing.T, cfg *apiConfig) []string {
+	t.Helper()
+	deletions, err := cfg.db.GetDueStorageDeletions(context.Background(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := []string{}
+	for _, deletion := range deletions {
+		refs = append(refs, deletion.Ref)
+	}
+	return refs
+}
+
+func validationStatus(status int) func(error) bool {
+	return func(err error) bool {
+		var validationErr *validation.Error
+		return errors.As(err, &validationErr) && validationErr.Status == status
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/progress"
+	"github.com/google/uuid"
+)
+
+// Resumable uploads: a client creates a session with the total size, sends
+// the file in PATCH chunks starting at the server's Upload-Offset (which a
+// HEAD request returns after a dropped connection) and finally completes
+// the session, which processes the staged file like a regular upload.
+// Sessions nothing was written to for UPLOAD_SESSION_EXPIRY_HOURS are
+// removed along with their staging files.
+
+// uploadSessionSweepInterval is how often expired upload sessions are
+// looked for.
+const uploadSessionSweepInterval = 10 * time.Minute
+
+func (cfg *apiConfig) handlerUploadSessionCreate(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideoForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || size <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Upload-Length header must be a positive size in bytes", err)
+		return
+	}
+	if size > maxVideoUploadSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Video is too large", nil)
+		return
+	}
+
+	if !requireIfMatch(w, r, video) {
+		return
+	}
+	if !cfg.transitionVideo(w, r, &video, database.VideoStatusUploading) {
+		return
+	}
+
+	staging, err := os.CreateTemp(cfg.uploadsRoot, "upload-*.part")
+	if err != nil {
+		cfg.abandonUpload(r.Context(), video)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create staging file", err)
+		return
+	}
+	staging.Close()
+
+	session, err := cfg.db.CreateUploadSession(r.Context(), database.CreateUploadSessionParams{
+		VideoID: video.ID,
+		UserID:  video.UserID,
+		Size:    size,
+	}, staging.Name())
+	if err != nil {
+		os.Remove(staging.Name())
+		cfg.abandonUpload(r.Context(), video)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload session", err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/uploads/"+session.ID.String())
+	w.Header().Set("Upload-Offset", "0")
+	respondWithJSON(w, http.StatusCreated, session)
+}
+
+func (cfg *apiConfig) handlerUploadSessionHead(w http.ResponseWriter, r *http.Request) {
+	session, ok := cfg.getUploadSessionForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(session.Size, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (cfg *apiConfig) handlerUploadSessionPatch(w http.ResponseWriter, r *http.Request) {
+	session, ok := cfg.getUploadSessionForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream", nil)
+		return
+	}
+	if session.CompletedAt != nil {
+		respondWithError(w, http.StatusConflict, "Upload is already complete", nil)
+		return
+	}
+
+	unlock, ok := cfg.lockUploadSession(session.ID)
+	if !ok {
+		respondWithError(w, http.StatusConflict, "Another chunk is being written to this upload", nil)
+		return
+	}
+	defer unlock()
+
+	//re-reading the offset now that we hold the lock
+	session, ok = cfg.reloadUploadSession(w, r, session.ID)
+	if !ok {
+		return
+	}
+	if session.CompletedAt != nil {
+		respondWithError(w, http.StatusConflict, "Upload is already complete", nil)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Offset header", err)
+		return
+	}
+	if offset != session.Offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("Upload-Offset must be %d", session.Offset), nil)
+		return
+	}
+
+	f, err := os.OpenFile(session.StagingPath, os.O_WRONLY, 0600)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open staging file", err)
+		return
+	}
+	defer f.Close()
+
+	//dropping anything past the recorded offset left over from an interrupted chunk
+	err = f.Truncate(session.Offset)
+	if err == nil {
+		_, err = f.Seek(session.Offset, io.SeekStart)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't prepare staging file", err)
+		return
+	}
+
+	//keeping whatever arrived before a dropped connection so the client can resume from there
+	body := http.MaxBytesReader(w, r.Body, session.Size-session.Offset)
+	received := progress.NewReader(body, func(n int64) {
+		cfg.progress.Publish(session.VideoID, progress.Event{Stage: progress.StageReceiving, Done: session.Offset + n, Total: session.Size})
+	})
+	written, copyErr := io.Copy(f, received)
+	if written > 0 {
+		if err := f.Sync(); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't write chunk", err)
+			return
+		}
+		if err := cfg.db.UpdateUploadSessionOffset(r.Context(), session.ID, session.Offset+written); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't save upload offset", err)
+			return
+		}
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset+written, 10))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(copyErr, &maxBytesErr) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Chunk goes past the end of the upload", copyErr)
+		return
+	}
+	if copyErr != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read chunk", copyErr)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUploadSessionComplete(w http.ResponseWriter, r *http.Request) {
+	session, ok := cfg.getUploadSessionForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	unlock, ok := cfg.lockUploadSession(session.ID)
+	if !ok {
+		respondWithError(w, http.StatusConflict, "A chunk is still being written to this upload", nil)
+		return
+	}
+	defer unlock()
+
+	session, ok = cfg.reloadUploadSession(w, r, session.ID)
+	if !ok {
+		return
+	}
+	if session.CompletedAt != nil {
+		respondWithError(w, http.StatusConflict, "Upload is already complete", nil)
+		return
+	}
+	if session.Offset != session.Size {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("Upload is incomplete, %d of %d bytes received", session.Offset, session.Size), nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), session.VideoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+
+	video, err = cfg.storeVideoFile(r.Context(), video, session.StagingPath, "")
+	if err != nil {
+		//the video failed, so the session can't be completed again
+		if removeErr := cfg.removeUploadSession(context.WithoutCancel(r.Context()), session); removeErr != nil {
+			log.Printf("couldn't delete upload session %s: %v", session.ID, removeErr)
+		}
+		respondWithVideoProcessingError(w, err)
+		return
+	}
+
+	err = cfg.db.CompleteUploadSession(r.Context(), session.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't complete upload session", err)
+		return
+	}
+	os.Remove(session.StagingPath)
+	cfg.uploadLocks.Delete(session.ID)
+
+	signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video url", err)
+		return
+	}
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, signedVideo)
+}
+
+func (cfg *apiConfig) handlerUploadSessionDelete(w http.ResponseWriter, r *http.Request) {
+	session, ok := cfg.getUploadSessionForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	unlock, ok := cfg.lockUploadSession(session.ID)
+	if !ok {
+		respondWithError(w, http.StatusConflict, "A chunk is still being written to this upload", nil)
+		return
+	}
+	defer unlock()
+
+	err := cfg.removeUploadSession(r.Context(), session)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete upload session", err)
+		return
+	}
+
+	//an abandoned upload doesn't leave the video stuck uploading
+	if session.CompletedAt == nil {
+		video, err := cfg.db.GetVideo(r.Context(), session.VideoID)
+		if err == nil && video.Status == database.VideoStatusUploading {
+			cfg.abandonUpload(r.Context(), video)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeUploadSession deletes the session along with its staging file and
+// lock. The caller has to hold the lock.
+func (cfg *apiConfig) removeUploadSession(ctx context.Context, session database.UploadSession) error {
+	err := cfg.db.DeleteUploadSession(ctx, session.ID)
+	if err != nil {
+		return err
+	}
+	os.Remove(session.StagingPath)
+	cfg.uploadLocks.Delete(session.ID)
+	return nil
+}
+
+// getUploadSessionForRequest loads the session named in the path and checks
+// it belongs to the authenticated user. It writes the error response itself.
+func (cfg *apiConfig) getUploadSessionForRequest(w http.ResponseWriter, r *http.Request) (database.UploadSession, bool) {
+	uploadID, err := uuid.Parse(r.PathValue("uploadID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid upload ID", err)
+		return database.UploadSession{}, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.UploadSession{}, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.UploadSession{}, false
+	}
+
+	session, err := cfg.db.GetUploadSession(r.Context(), uploadID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Upload session not found", err)
+		return database.UploadSession{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload session", err)
+		return database.UploadSession{}, false
+	}
+	if session.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Upload session not found", nil)
+		return database.UploadSession{}, false
+	}
+	return session, true
+}
+
+// reloadUploadSession reads the session again once its lock is held, in
+// case it changed or expired meanwhile. It writes the error response itself.
+func (cfg *apiConfig) reloadUploadSession(w http.ResponseWriter, r *http.Request, id uuid.UUID) (database.UploadSession, bool) {
+	session, err := cfg.db.GetUploadSession(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Upload session not found", err)
+		return database.UploadSession{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload session", err)
+		return database.UploadSession{}, false
+	}
+	return session, true
+}
+
+// lockUploadSession makes sure only one request at a time writes to a
+// session's staging file. Whoever removes the session also drops its lock
+// while holding it.
+func (cfg *apiConfig) lockUploadSession(id uuid.UUID) (func(), bool) {
+	value, _ := cfg.uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	if !mu.TryLock() {
+		return nil, false
+	}
+	return mu.Unlock, true
+}
+
+// runUploadSessionExpiry removes upload sessions nothing was written to for
+// longer than the expiry, along with their staging files, and gives up on
+// direct uploads that weren't completed in that time.
+func (cfg *apiConfig) runUploadSessionExpiry(ctx context.Context) {
+	ticker := time.NewTicker(uploadSessionSweepInterval)
+	defer ticker.Stop()
+	for {
+		cutoff := time.Now().Add(-cfg.uploadExpiry)
+		cfg.expireUploadSessions(ctx, cutoff)
+		cfg.expireDirectUploads(ctx, cutoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) expireUploadSessions(ctx context.Context, cutoff time.Time) {
+	sessions, err := cfg.db.GetStaleUploadSessions(ctx, cutoff)
+	if err != nil {
+		log.Printf("couldn't get stale upload sessions: %v", err)
+		return
+	}
+
+	expired := 0
+	inUse := map[string]bool{}
+	for _, session := range sessions {
+		unlock, ok := cfg.lockUploadSession(session.ID)
+		if !ok {
+			//a chunk is arriving right now
+			inUse[session.StagingPath] = true
+			continue
+		}
+		err := cfg.db.DeleteUploadSession(ctx, session.ID)
+		if err != nil {
+			unlock()
+			inUse[session.StagingPath] = true
+			log.Printf("couldn't delete upload session %s: %v", session.ID, err)
+			continue
+		}
+		os.Remove(session.StagingPath)
+		cfg.uploadLocks.Delete(session.ID)
+		unlock()
+		expired++
+
+		//the video goes back to where it was, unless a newer upload started since
+		if session.CompletedAt == nil {
+			video, err := cfg.db.GetVideo(ctx, session.VideoID)
+			if err == nil && video.Status == database.VideoStatusUploading && video.UpdatedAt.Before(cutoff) {
+				cfg.abandonUpload(ctx, video)
+			}
+		}
+	}
+
+	//staging files can outlive their session when the server stops at the wrong moment
+	staged, err := filepath.Glob(filepath.Join(cfg.uploadsRoot, "upload-*.part"))
+	if err != nil {
+		log.Printf("couldn't list staging files: %v", err)
+	}
+	for _, path := range staged {
+		info, err := os.Stat(path)
+		if err == nil && info.ModTime().Before(cutoff) && !inUse[path] {
+			os.Remove(path)
+		}
+	}
+
+	if expired > 0 {
+		log.Printf("expired %d upload sessions", expired)
+	}
+}
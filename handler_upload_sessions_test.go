@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// newTestUploadSession starts a resumable upload of a new video.
+func newTestUploadSession(t *testing.T, cfg *apiConfig, user *database.User) database.UploadSession {
+	t.Helper()
+	ctx := context.Background()
+	video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "upload", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.db.TransitionVideoStatus(ctx, video.ID, database.VideoStatusUploading, ""); err != nil {
+		t.Fatal(err)
+	}
+	staging, err := os.CreateTemp(cfg.uploadsRoot, "upload-*.part")
+	if err != nil {
+		t.Fatal(err)
+	}
+	staging.Close()
+	session, err := cfg.db.CreateUploadSession(ctx, database.CreateUploadSessionParams{VideoID: video.ID, UserID: user.ID, Size: 10}, staging.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestUploadSessionDeleteDropsLock(t *testing.T) {
+	cfg, user := newTestConfig(t)
+	session := newTestUploadSession(t, cfg, user)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/uploads/"+session.ID.String(), nil)
+	req.SetPathValue("uploadID", session.ID.String())
+	authorize(t, cfg, req, user)
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadSessionDelete(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if _, ok := cfg.uploadLocks.Load(session.ID); ok {
+		t.Errorf("lock of the deleted session is still there")
+	}
+	if _, err := os.Stat(session.StagingPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("staging file still exists: %v", err)
+	}
+}
+
+func TestUploadSessionCompleteDropsFailedSession(t *testing.T) {
+	cfg, user := newTestConfig(t)
+	ctx := context.Background()
+	session := newTestUploadSession(t, cfg, user)
+	//every byte arrived, but it isn't a video
+	if err := os.WriteFile(session.StagingPath, []byte("not a vid!"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.db.UpdateUploadSessionOffset(ctx, session.ID, session.Size); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/uploads/"+session.ID.String()+"/complete", nil)
+	req.SetPathValue("uploadID", session.ID.String())
+	authorize(t, cfg, req, user)
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadSessionComplete(rec, req)
+
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := cfg.db.GetUploadSession(ctx, session.ID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("failed upload session is still there: %v", err)
+	}
+	if _, err := os.Stat(session.StagingPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("staging file still exists: %v", err)
+	}
+	if _, ok := cfg.uploadLocks.Load(session.ID); ok {
+		t.Errorf("lock of the failed session is still there")
+	}
+	video, err := cfg.db.GetVideo(ctx, session.VideoID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.Status != database.VideoStatusFailed {
+		t.Errorf("video is %s, want %s", video.Status, database.VideoStatusFailed)
+	}
+}
+
+func TestExpireUploadSessions(t *testing.T) {
+	cfg, user := newTestConfig(t)
+	ctx := context.Background()
+	stale := newTestUploadSession(t, cfg, user)
+	busy := newTestUploadSession(t, cfg, user)
+	orphan := filepath.Join(cfg.uploadsRoot, "upload-orphan.part")
+	if err := os.WriteFile(orphan, []byte("chunk"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	//a chunk is being written to the busy session
+	unlock, ok := cfg.lockUploadSession(busy.ID)
+	if !ok {
+		t.Fatal("couldn't lock session")
+	}
+	defer unlock()
+	cfg.expireUploadSessions(ctx, time.Now().Add(time.Hour))
+
+	if _, err := cfg.db.GetUploadSession(ctx, stale.ID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("stale session wasn't removed: %v", err)
+	}
+	if _, ok := cfg.uploadLocks.Load(stale.ID); ok {
+		t.Errorf("lock of the expired session is still there")
+	}
+	if _, err := os.Stat(orphan); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("orphaned staging file still exists: %v", err)
+	}
+	video, err := cfg.db.GetVideo(ctx, stale.VideoID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.Status != database.VideoStatusDraft {
+		t.Errorf("video of the expired upload is %s, want draft", video.Status)
+	}
+
+	if _, err := cfg.db.GetUploadSession(ctx, busy.ID); err != nil {
+		t.Errorf("session being written to was removed: %v", err)
+	}
+	if _, err := os.Stat(busy.StagingPath); err != nil {
+		t.Errorf("staging file being written to was removed: %v", err)
+	}
+}
+
+func TestExpireUploadSessionsKeepsRecentOnes(t *testing.T) {
+	cfg, user := newTestConfig(t)
+	ctx := context.Background()
+	session := newTestUploadSession(t, cfg, user)
+
+	cfg.expireUploadSessions(ctx, time.Now().Add(-time.Hour))
+
+	if _, err := cfg.db.GetUploadSession(ctx, session.ID); err != nil {
+		t.Errorf("recent session was removed: %v", err)
+	}
+	if _, err := os.Stat(session.StagingPath); err != nil {
+		t.Errorf("recent staging file was removed: %v", err)
+	}
+}
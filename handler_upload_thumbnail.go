@@ -1,17 +1,13 @@
 package main
 
 import (
-	"crypto/rand"
-	"encoding/base64"
-	"fmt"
+	"bytes"
+	"errors"
 	"io"
-	"mime"
 	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
@@ -35,12 +31,21 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	fmt.Println("uploading thumbnail for video", videoID, "by user", userID)
+	//the form's other fields and boundaries get a little room on top of the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxThumbnailSize+1<<20)
 
-	// TODO: implement the upload here
 	//setting max memory to 10MB
 	const maxMemory = 10 << 20
-	r.ParseMultipartForm(maxMemory)
+	err = r.ParseMultipartForm(maxMemory)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "Thumbnail is too large", err)
+			return
+		}
+		respondWithError(w, http.StatusBadRequest, "request must be multipart/form-data", err)
+		return
+	}
 
 	//get the image data from the form using r.Formfile to get the file data and headers
 	fileData, fileHeader, err := r.FormFile("thumbnail")
@@ -49,23 +54,30 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 	defer fileData.Close()
-	//using the mime.parsemediatype to get media type from header
+	//the media type from the header has to match what the file actually contains
 	mediaType := fileHeader.Header.Get("Content-Type")
-	if extensionType, _, err := mime.ParseMediaType(mediaType); extensionType != "image/png" && extensionType != "image/jpeg" {
-		respondWithError(w, http.StatusBadRequest, "wrong media type to upload", err)
+
+	//reading all image data into a byte slice for the image pipeline
+	imageData, err := io.ReadAll(io.LimitReader(fileData, maxThumbnailSize+1))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "couldn't read file", err)
+		return
+	}
+	_, err = thumbnailUploadRule.Validate(bytes.NewReader(imageData), int64(len(imageData)), mediaType)
+	if respondWithValidationError(w, err) {
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't validate file", err)
 		return
 	}
-
-	//reading all image data into a byte slice
-	//var imageData []byte
-	// imageData, err := io.ReadAll(fileData)
-	// if err != nil {
-	// 	respondWithError(w, http.StatusBadRequest, "couldn't read file", err)
-	// 	return
-	// }
 
 	//get the video metadata from the sqlite database
-	dbVideo, err := cfg.db.GetVideo(videoID)
+	dbVideo, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video not found", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "couldnt find video", err)
 		return
@@ -75,43 +87,50 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		respondWithError(w, http.StatusUnauthorized, "Wrong user id", err)
 		return
 	}
+	if !requireIfMatch(w, r, dbVideo) {
+		return
+	}
 
-	//save thumbnail to global map
-	// thumbNail := thumbnail{data: imageData, mediaType: mediaType}
-	// videoThumbnails[videoID] = thumbNail
-
-	//updating handler to store the files on the file system on the /assets directory
-	//path is /assets/<videoID>.<file extension>
-	file_extension := strings.Split(mediaType, "/")[1]
+	//resizing into renditions and storing them in the configured object store under thumbnails/
+	thumbnailUrl, renditions, err := cfg.putThumbnail(r.Context(), "thumbnails/", imageData)
+	var procErr *processingError
+	if errors.As(err, &procErr) {
+		respondWithError(w, http.StatusUnprocessableEntity, procErr.Error(), err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to store thumbnail", err)
+		return
+	}
 
-	//using a crypto/rand.Read and base64.RawURLencoding to create a new filepathUrl
-	key := make([]byte, 32)
-	rand.Read(key)
-	pathString := base64.RawURLEncoding.EncodeToString(key)
-	var filepathURL = filepath.Join(cfg.assetsRoot, pathString+"."+file_extension)
-	//use os.create to create the new file
-	filePath, err := os.Create(filepathURL)
+	//only the thumbnail is set on the latest version, so a video upload finishing meanwhile isn't undone
+	dbVideo, err = cfg.db.ModifyVideo(r.Context(), videoID, func(video *database.Video) error {
+		if err := checkIfMatch(r, *video); err != nil {
+			return err
+		}
+		video.ThumbnailURL = &thumbnailUrl
+		video.ThumbnailRenditions = renditions
+		return nil
+	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "couldnt create thumbnail file", err)
+		//nothing references the new renditions
+		cfg.discardMedia(r.Context(), thumbnailRefs(renditions))
+	}
+	if respondWithVideoChanged(w, err) {
 		return
 	}
-	defer filePath.Close()
-	//copy the contents from the multipart.file to the new disk file using io.copy
-	_, err = io.Copy(filePath, fileData)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "failed to copy to disk", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update thumbnail url", err)
 		return
 	}
 
-	//update the thumbnail url
-	root := strings.Split(cfg.assetsRoot, ".")[1]
-	fmt.Println(root)
-	var thumbnailUrl = fmt.Sprintf("http://localhost:%s/%s/%s.%s", cfg.port, root, pathString, file_extension)
-
-	dbVideo.ThumbnailURL = &thumbnailUrl
-	cfg.db.UpdateVideo(dbVideo)
-
 	//respond with the update JSON of the video's metadata
-	respondWithJSON(w, http.StatusOK, dbVideo)
+	signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), dbVideo)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't sign video urls", err)
+		return
+	}
+	w.Header().Set("ETag", videoETag(dbVideo))
+	respondWithJSON(w, http.StatusOK, signedVideo)
 
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestUploadThumbnailRejectsBadForms(t *testing.T) {
+	cfg, user := newTestConfig(t)
+	video, err := cfg.db.CreateVideo(context.Background(), database.CreateVideoParams{Title: "thumbnail", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tooLarge := &bytes.Buffer{}
+	mw := multipart.NewWriter(tooLarge)
+	part, err := mw.CreateFormFile("thumbnail", "thumbnail.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(make([]byte, maxThumbnailSize+2<<20))
+	mw.Close()
+
+	tests := []struct {
+		name        string
+		body        *strings.Reader
+		contentType string
+		want        int
+	}{
+		{"not multipart", strings.NewReader(`{"thumbnail":"x"}`), "application/json", http.StatusBadRequest},
+		{"too large", strings.NewReader(tooLarge.String()), mw.FormDataContentType(), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/thumbnail_upload/"+video.ID.String(), tt.body)
+			r.Header.Set("Content-Type", tt.contentType)
+			r.SetPathValue("videoID", video.ID.String())
+			authorize(t, cfg, r, user)
+			w := httptest.NewRecorder()
+			cfg.handlerUploadThumbnail(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
@@ -1,27 +1,21 @@
 package main
 
 import (
-	"context"
-	"crypto/rand"
-	"encoding/base64"
-	"fmt"
+	"errors"
 	"io"
-	"log"
-	"mime"
+	"mime/multipart"
 	"net/http"
 	"os"
-	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/progress"
 	"github.com/google/uuid"
 )
 
 func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
 	//setting upload limit to 1GB
-	uploadLimt := 1 << 20
-	http.MaxBytesReader(w, r.Body, int64(uploadLimt))
+	r.Body = http.MaxBytesReader(w, r.Body, maxVideoUploadSize)
 
 	//extracting video Id from Url path parameter and parseing to uuid
 	videoIDString := r.PathValue("videoID")
@@ -45,7 +39,11 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	}
 
 	//getting video metadata
-	video, err := cfg.db.GetVideo(parsedVideoID)
+	video, err := cfg.db.GetVideo(r.Context(), parsedVideoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video not found", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "couldnt get video", err)
 		return
@@ -54,62 +52,74 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusUnauthorized, "Not authorized to update this video", nil)
 		return
 	}
-	//parsing the uploaded video file
-	fileMultipart, fileHeader, err := r.FormFile("video")
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "couldn't parse video file", err)
+	if !requireIfMatch(w, r, video) {
+		return
+	}
+	//refusing a second upload while one is being processed
+	if !cfg.transitionVideo(w, r, &video, database.VideoStatusUploading) {
 		return
 	}
-	defer fileMultipart.Close()
 
-	mediaType := fileHeader.Header.Get("Content-Type")
-	if extensionType, _, err := mime.ParseMediaType(mediaType); extensionType != "video/mp4" {
-		respondWithError(w, http.StatusBadRequest, "type uploaded isn't mp4", err)
+	//reading the multipart body as it arrives, FormFile would only return once all of it was spooled to disk
+	reader, err := r.MultipartReader()
+	if err != nil {
+		cfg.abandonUpload(r.Context(), video)
+		respondWithError(w, http.StatusBadRequest, "request must be multipart/form-data", err)
+		return
+	}
+	var part *multipart.Part
+	for {
+		part, err = reader.NextPart()
+		if err != nil || part.FormName() == "video" {
+			break
+		}
+		part.Close()
+	}
+	if err != nil {
+		cfg.abandonUpload(r.Context(), video)
+		respondWithError(w, http.StatusBadRequest, "couldn't find video file", err)
 		return
 	}
+	defer part.Close()
+
+	//the declared type is checked against the file's content before processing
+	mediaType := part.Header.Get("Content-Type")
 
 	//saving the uploaded file into a temporary file
-	f, err := os.CreateTemp("", "tubely-upload.mp4")
+	f, err := os.CreateTemp("", "tubely-upload-*.mp4")
 	if err != nil {
-		log.Fatal(err)
+		cfg.abandonUpload(r.Context(), video)
+		respondWithError(w, http.StatusInternalServerError, "couldnt create temp file", err)
+		return
 	}
 	defer os.Remove(f.Name())
+	defer f.Close()
 
-	_, err = io.Copy(f, fileMultipart)
+	//reporting bytes received to anyone watching the video's events, the
+	//request's length is the closest thing to the file's size there is
+	total := max(r.ContentLength, 0)
+	received := progress.NewReader(part, func(n int64) {
+		cfg.progress.Publish(video.ID, progress.Event{Stage: progress.StageReceiving, Done: n, Total: total})
+	})
+	_, err = io.Copy(f, received)
 	if err != nil {
+		cfg.abandonUpload(r.Context(), video)
 		respondWithError(w, http.StatusBadRequest, "couldnt copy file", err)
 		return
 	}
 
-	//resetting the temp file's pointer to the beginning
-	f.Seek(0, io.SeekStart)
-
-	//putting the object into s3 using putobject. We need bucket name,file key,file contents,content type
-	file_extension := strings.Split(mediaType, "/")[1]
-	key := make([]byte, 32)
-	rand.Read(key)
-	pathString := base64.RawURLEncoding.EncodeToString(key) + "." + file_extension
-
-	_, err = cfg.s3Client.PutObject(context.Background(), &s3.PutObjectInput{
-		Bucket:      &cfg.s3Bucket,
-		Key:         &pathString,
-		Body:        f,
-		ACL:         types.ObjectCannedACLPublicRead,
-		ContentType: &mediaType,
-	})
+	//processing the temp file into the object store
+	video, err = cfg.storeVideoFile(r.Context(), video, f.Name(), mediaType)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "couldnt upload to s3 bucket", err)
+		respondWithVideoProcessingError(w, err)
 		return
 	}
 
-	//updatnig video url in database to reflect bucket. bucket address in the format https://<bucket-name>.s3.<region>.amazonaws.com/<key>
-
-	var filepathURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", cfg.s3Bucket, cfg.s3Region, pathString)
-	video.VideoURL = &filepathURL
-	err = cfg.db.UpdateVideo(video)
+	signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), video)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "couldnt update video url", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't sign video url", err)
 		return
 	}
-
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, signedVideo)
 }
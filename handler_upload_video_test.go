@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/progress"
+)
+
+func TestUploadVideoReadsMultipartStream(t *testing.T) {
+	cfg, user := newTestConfig(t)
+	ctx := context.Background()
+	video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "upload", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//a field before the file is skipped, the file itself isn't an mp4
+	data := bytes.Repeat([]byte("not a video "), 100)
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	if err := mw.WriteField("note", "skipped"); err != nil {
+		t.Fatal(err)
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="video"; filename="video.mp4"`)
+	header.Set("Content-Type", "video/mp4")
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	mw.Close()
+
+	events, unsubscribe := cfg.progress.Subscribe(video.ID)
+	defer unsubscribe()
+
+	r := httptest.NewRequest(http.MethodPost, "/api/video_upload/"+video.ID.String(), body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	r.SetPathValue("videoID", video.ID.String())
+	authorize(t, cfg, r, user)
+	w := httptest.NewRecorder()
+	cfg.handlerUploadVideo(w, r)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("uploading text as an mp4: %d %s", w.Code, w.Body)
+	}
+
+	var received int64
+	for len(events) > 0 {
+		if event := <-events; event.Stage == progress.StageReceiving {
+			received = event.Done
+		}
+	}
+	if received != int64(len(data)) {
+		t.Errorf("reported %d bytes received, want %d", received, len(data))
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/api/video_upload/"+video.ID.String(), bytes.NewBufferString("{}"))
+	r.Header.Set("Content-Type", "application/json")
+	r.SetPathValue("videoID", video.ID.String())
+	authorize(t, cfg, r, user)
+	w = httptest.NewRecorder()
+	cfg.handlerUploadVideo(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("upload without a multipart body: %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/progress"
+	"github.com/google/uuid"
+)
+
+// sseHeartbeat keeps idle event streams from being closed by proxies.
+const sseHeartbeat = 15 * time.Second
+
+// eventsTokenExpiry is how long an events token can be used to connect. It
+// ends up in URLs and logs, and is only checked when the stream opens.
+const eventsTokenExpiry = time.Minute
+
+// handlerVideoEventsToken hands out a short-lived token for watching the
+// video's events, since EventSource can't send the access token in a header.
+func (cfg *apiConfig) handlerVideoEventsToken(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	video, ok := cfg.getOwnedVideoForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := auth.MakeEventsJWT(video.UserID, video.ID, cfg.jwtSecret, eventsTokenExpiry)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create events token", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{
+		Token:     token,
+		ExpiresAt: time.Now().UTC().Add(eventsTokenExpiry),
+	})
+}
+
+// handlerVideoEvents streams upload and processing progress of a video as
+// server-sent events. Besides the access token in the Authorization header
+// it takes an events token for the video in the token query parameter.
+func (cfg *apiConfig) handlerVideoEvents(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	var userID uuid.UUID
+	if token := r.URL.Query().Get("token"); token != "" {
+		userID, err = auth.ValidateEventsJWT(token, cfg.jwtSecret, videoID)
+	} else {
+		var bearer string
+		bearer, err = auth.GetBearerToken(r.Header)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+			return
+		}
+		userID, err = auth.ValidateJWT(bearer, cfg.jwtSecret)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+
+	//subscribing before sending the current status so nothing is missed in between
+	events, unsubscribe := cfg.progress.Subscribe(videoID)
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	//the stream stays open for as long as the client listens
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	//clients that connect without an upload in progress still learn where the video is at
+	if len(events) == 0 {
+		if event, ok := statusEvent(video); ok {
+			writeEvent(w, event)
+		}
+	}
+	rc.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case event := <-events:
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event progress.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: progress\ndata: %s\n\n", data)
+	return err
+}
+
+// statusEvent describes a video's stored status as a progress event.
+func statusEvent(video database.Video) (progress.Event, bool) {
+	switch video.Status {
+	case database.VideoStatusProcessing:
+		return progress.Event{Stage: progress.StageProcessing}, true
+	case database.VideoStatusReady:
+		return progress.Event{Stage: progress.StageReady}, true
+	case database.VideoStatusFailed:
+		event := progress.Event{Stage: progress.StageFailed}
+		if video.FailureReason != nil {
+			event.Error = *video.FailureReason
+		}
+		return event, true
+	}
+	return progress.Event{}, false
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestVideoEventsToken(t *testing.T) {
+	cfg, user := newTestConfig(t)
+	video, err := cfg.db.CreateVideo(context.Background(), database.CreateVideoParams{Title: "events", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/videos/"+video.ID.String()+"/events/token", nil)
+	r.SetPathValue("videoID", video.ID.String())
+	authorize(t, cfg, r, user)
+	w := httptest.NewRecorder()
+	cfg.handlerVideoEventsToken(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("events token: %d %s", w.Code, w.Body)
+	}
+	var body struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(body.ExpiresAt) > eventsTokenExpiry {
+		t.Errorf("events token expires at %v", body.ExpiresAt)
+	}
+
+	access, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"events token", body.Token, http.StatusOK},
+		{"access token", access, http.StatusUnauthorized},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/videos/{videoID}/events", cfg.handlerVideoEvents)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := http.Get(srv.URL + "/api/videos/" + video.ID.String() + "/events?token=" + url.QueryEscape(tt.token))
+			if err != nil {
+				t.Fatal(err)
+			}
+			//the stream stays open, only the status is of interest
+			res.Body.Close()
+			if res.StatusCode != tt.want {
+				t.Errorf("events with an %s in the URL: %d, want %d", tt.name, res.StatusCode, tt.want)
+			}
+		})
+	}
+}
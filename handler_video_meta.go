@@ -2,7 +2,14 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
@@ -33,13 +40,25 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 	params.UserID = userID
+	params.Title = strings.TrimSpace(params.Title)
+	err = validateVideoText(params.Title, params.Description)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	params.Tags, err = normalizeTags(params.Tags)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
 
-	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
+	video, err := cfg.db.CreateVideo(r.Context(), params.CreateVideoParams)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create video", err)
 		return
 	}
 
+	w.Header().Set("ETag", videoETag(video))
 	respondWithJSON(w, http.StatusCreated, video)
 }
 
@@ -62,17 +81,29 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video not found", err)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
 		return
 	}
 	if video.UserID != userID {
 		respondWithError(w, http.StatusForbidden, "You can't delete this video", err)
 		return
 	}
+	if !requireIfMatch(w, r, video) {
+		return
+	}
 
-	err = cfg.db.DeleteVideo(videoID)
+	//deleted videos stay in the trash until they're restored or purged
+	err = cfg.db.TrashVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video not found", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
@@ -82,23 +113,135 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 }
 
 func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
+	video, ok := cfg.getViewableVideoForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URLs", err)
+		return
+	}
+
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, signedVideo)
+}
+
+// getViewableVideoForRequest loads the video named in the path if the
+// request may see it. Public videos are visible to anyone, private ones
+// only to their owner, either logged in or holding a playback token for
+// the video. Everyone else gets a 404, like for a video that doesn't exist.
+// It writes the error response itself.
+func (cfg *apiConfig) getViewableVideoForRequest(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return database.Video{}, false
+	}
+
+	//logging in is optional, a token that's there has to be valid though
+	var userID uuid.UUID
+	if token := r.URL.Query().Get("token"); token != "" {
+		userID, err = auth.ValidatePlaybackJWT(token, cfg.jwtSecret, videoID)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate playback token", err)
+			return database.Video{}, false
+		}
+	} else if token, err := auth.GetBearerToken(r.Header); err == nil {
+		userID, err = auth.ValidateJWT(token, cfg.jwtSecret)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+			return database.Video{}, false
+		}
+	} else if !errors.Is(err, auth.ErrNoAuthHeaderIncluded) {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Video{}, false
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video not found", err)
+		return database.Video{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if !video.IsPublic && (userID == uuid.Nil || video.UserID != userID) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
+
+// handlerVideoMetaUpdate applies a JSON merge patch (RFC 7396) to the
+// video's title, description, tags and visibility. A null removes the
+// description and tags and makes the video private.
+func (cfg *apiConfig) handlerVideoMetaUpdate(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideoForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/merge-patch+json", nil)
+		return
+	}
+	//refusing to overwrite changes the client hasn't seen
+	if !requireIfMatch(w, r, video) {
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	r.Body = http.MaxBytesReader(w, r.Body, maxVideoPatchSize)
+	var patch map[string]json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&patch)
+	if err != nil || patch == nil {
+		respondWithError(w, http.StatusBadRequest, "Patch must be a JSON object", err)
+		return
+	}
+
+	//without If-Match the patch is applied again on top of whatever changed meanwhile
+	var patchErr error
+	video, err = cfg.db.ModifyVideo(r.Context(), video.ID, func(video *database.Video) error {
+		if err := checkIfMatch(r, *video); err != nil {
+			return err
+		}
+		patchErr = applyVideoPatch(video, patch)
+		return patchErr
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video not found", err)
+		return
+	}
+	if respondWithVideoChanged(w, err) {
+		return
+	}
+	if patchErr != nil {
+		respondWithError(w, http.StatusBadRequest, patchErr.Error(), patchErr)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, video)
+	signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URLs", err)
+		return
+	}
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, signedVideo)
 }
 
 func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Videos     []database.Video `json:"videos"`
+		NextCursor *string          `json:"next_cursor"`
+	}
+
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
@@ -110,11 +253,158 @@ func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	videos, err := cfg.db.GetVideos(userID)
+	query := r.URL.Query()
+	params := database.GetVideosParams{
+		UserID: userID,
+		Status: database.VideoStatus(query.Get("status")),
+		Query:  query.Get("q"),
+		Sort:   database.VideoSort(query.Get("sort")),
+		Cursor: query.Get("cursor"),
+	}
+	if params.Status != "" && !params.Status.Valid() {
+		respondWithError(w, http.StatusBadRequest, "Invalid video status", nil)
+		return
+	}
+	if params.Sort == "" {
+		params.Sort = database.VideoSortCreated
+	}
+	if !params.Sort.Valid() {
+		respondWithError(w, http.StatusBadRequest, "sort must be created, updated, title or duration", nil)
+		return
+	}
+	switch query.Get("order") {
+	case "":
+		params.Descending = params.Sort.DefaultDescending()
+	case "asc":
+	case "desc":
+		params.Descending = true
+	default:
+		respondWithError(w, http.StatusBadRequest, "order must be asc or desc", nil)
+		return
+	}
+	if limit := query.Get("limit"); limit != "" {
+		params.Limit, err = strconv.Atoi(limit)
+		if err != nil || params.Limit < 1 || params.Limit > database.MaxVideoPageSize {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", database.MaxVideoPageSize), err)
+			return
+		}
+	}
+
+	page, err := cfg.db.GetVideos(r.Context(), params)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, videos)
+	signedVideos, err := cfg.dbVideosToSignedVideos(r.Context(), page.Videos)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URLs", err)
+		return
+	}
+
+	//the cursor is null on the last page
+	var nextCursor *string
+	if page.NextCursor != "" {
+		nextCursor = &page.NextCursor
+	}
+	respondWithJSON(w, http.StatusOK, response{
+		Videos:     signedVideos,
+		NextCursor: nextCursor,
+	})
+}
+
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 5000
+	maxTags              = 20
+	maxTagLength         = 50
+	maxVideoPatchSize    = 64 << 10
+)
+
+// applyVideoPatch sets the fields present in patch on video. Fields that
+// aren't editable are rejected rather than ignored.
+func applyVideoPatch(video *database.Video, patch map[string]json.RawMessage) error {
+	fields := make([]string, 0, len(patch))
+	for field := range patch {
+		fields = append(fields, field)
+	}
+	//checking in a fixed order so the same patch always gets the same error
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		value := patch[field]
+		isNull := string(value) == "null"
+		switch field {
+		case "title":
+			var title string
+			if isNull || json.Unmarshal(value, &title) != nil {
+				return errors.New("title must be a string")
+			}
+			video.Title = strings.TrimSpace(title)
+		case "description":
+			var description string
+			if !isNull && json.Unmarshal(value, &description) != nil {
+				return errors.New("description must be a string")
+			}
+			video.Description = description
+		case "tags":
+			var tags []string
+			if !isNull && json.Unmarshal(value, &tags) != nil {
+				return errors.New("tags must be a list of strings")
+			}
+			normalized, err := normalizeTags(tags)
+			if err != nil {
+				return err
+			}
+			video.Tags = normalized
+		case "is_public":
+			var isPublic bool
+			if !isNull && json.Unmarshal(value, &isPublic) != nil {
+				return errors.New("is_public must be true or false")
+			}
+			video.IsPublic = isPublic
+		default:
+			return fmt.Errorf("%s can't be changed", field)
+		}
+	}
+	return validateVideoText(video.Title, video.Description)
+}
+
+// validateVideoText checks the lengths of a video's title and description.
+func validateVideoText(title, description string) error {
+	if title == "" {
+		return errors.New("title can't be empty")
+	}
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		return fmt.Errorf("title can be at most %d characters long", maxTitleLength)
+	}
+	if utf8.RuneCountInString(description) > maxDescriptionLength {
+		return fmt.Errorf("description can be at most %d characters long", maxDescriptionLength)
+	}
+	return nil
+}
+
+// normalizeTags lowercases and trims tags and drops empty and repeated ones.
+func normalizeTags(tags []string) (database.Tags, error) {
+	normalized := database.Tags{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, fmt.Errorf("tags can be at most %d characters long", maxTagLength)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTags {
+		return nil, fmt.Errorf("a video can have at most %d tags", maxTags)
+	}
+	return normalized, nil
 }
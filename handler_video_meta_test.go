@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestVideoVisibility(t *testing.T) {
+	cfg, owner := newTestConfig(t)
+	ctx := context.Background()
+	other, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "other@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "private", UserID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "public", UserID: owner.ID, IsPublic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		video  database.Video
+		viewer *database.User
+		header string
+		want   int
+	}{
+		{"owner of a private video", private, owner, "", http.StatusOK},
+		{"someone else's private video", private, other, "", http.StatusNotFound},
+		{"anonymous private video", private, nil, "", http.StatusNotFound},
+		{"anonymous public video", public, nil, "", http.StatusOK},
+		{"someone else's public video", public, other, "", http.StatusOK},
+		{"invalid token", public, nil, "Bearer nonsense", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/videos/"+tt.video.ID.String(), nil)
+			r.SetPathValue("videoID", tt.video.ID.String())
+			if tt.viewer != nil {
+				authorize(t, cfg, r, tt.viewer)
+			}
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			cfg.handlerVideoGet(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestHLSPlaylistPlaybackToken(t *testing.T) {
+	cfg, owner := newTestConfig(t)
+	ctx := context.Background()
+	video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "hls", UserID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := "hls/" + video.ID.String() + "/abc/master.m3u8"
+	if err := cfg.store.Put(ctx, key, strings.NewReader("#EXTM3U\n720p.m3u8\n"), "application/vnd.apple.mpegurl"); err != nil {
+		t.Fatal(err)
+	}
+	manifestRef := cfg.mediaRef(key)
+	if _, err := cfg.db.ModifyVideo(ctx, video.ID, func(v *database.Video) error {
+		v.HLSURL = &manifestRef
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := auth.MakePlaybackJWT(owner.ID, video.ID, cfg.jwtSecret, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := auth.MakePlaybackJWT(owner.ID, owner.ID, cfg.jwtSecret, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"playback token", "?token=" + url.QueryEscape(token), http.StatusOK},
+		{"token for another video", "?token=" + url.QueryEscape(other), http.StatusUnauthorized},
+		{"no token", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/videos/"+video.ID.String()+"/hls/master.m3u8"+tt.query, nil)
+			r.SetPathValue("videoID", video.ID.String())
+			r.SetPathValue("file", "master.m3u8")
+			w := httptest.NewRecorder()
+			cfg.handlerHLSPlaylist(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			//variant playlists keep the token so the player can fetch them too
+			if tt.want == http.StatusOK && !strings.Contains(w.Body.String(), "720p.m3u8"+tt.query+"\n") {
+				t.Errorf("playlist = %q", w.Body)
+			}
+		})
+	}
+}
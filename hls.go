@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/jobs"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+const jobTypeTranscodeHLS = "transcode_hls"
+
+// errVideoReplaced stops a transcode from being saved when another file was
+// uploaded for the video while it ran.
+var errVideoReplaced = errors.New("video file was replaced")
+
+type transcodeHLSPayload struct {
+	VideoID  uuid.UUID `json:"video_id"`
+	VideoRef string    `json:"video_ref"`
+}
+
+// enqueueTranscode schedules HLS transcoding for the video's current file
+// through db, which may be a transaction.
+func enqueueTranscode(ctx context.Context, db database.Client, video database.Video) error {
+	if video.VideoURL == nil {
+		return nil
+	}
+	_, err := jobs.Enqueue(ctx, db, jobTypeTranscodeHLS, transcodeHLSPayload{
+		VideoID:  video.ID,
+		VideoRef: *video.VideoURL,
+	}, &video.UserID)
+	if err != nil {
+		return fmt.Errorf("couldn't enqueue hls transcode: %w", err)
+	}
+	return nil
+}
+
+// handleTranscodeHLSJob produces the HLS ladder for a video and uploads it
+// under hls/<videoID>/<random>/.
+func (cfg *apiConfig) handleTranscodeHLSJob(ctx context.Context, job database.Job) error {
+	var payload transcodeHLSPayload
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+
+	video, err := cfg.db.GetVideo(ctx, payload.VideoID)
+	if errors.Is(err, database.ErrNotFound) {
+		//the video was deleted, nothing to transcode
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if video.VideoURL == nil || *video.VideoURL != payload.VideoRef {
+		//the video was replaced, a newer job takes care of it
+		return nil
+	}
+	key, ok := cfg.mediaKey(payload.VideoRef)
+	if !ok {
+		return jobs.Permanent(fmt.Errorf("video %s isn't in the object store", video.ID))
+	}
+
+	workDir, err := os.MkdirTemp("", "tubely-hls-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	sourcePath := filepath.Join(workDir, "source.mp4")
+	if err := cfg.downloadObject(ctx, key, sourcePath); err != nil {
+		return err
+	}
+	info, err := media.Probe(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+
+	outDir := filepath.Join(workDir, "hls")
+	if err := media.TranscodeHLS(ctx, sourcePath, outDir, info, media.DefaultLadder); err != nil {
+		return err
+	}
+
+	random := make([]byte, 16)
+	rand.Read(random)
+	prefix := fmt.Sprintf("hls/%s/%s/", video.ID, base64.RawURLEncoding.EncodeToString(random))
+	err = filepath.WalkDir(outDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(outDir, p)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return cfg.store.Put(ctx, prefix+filepath.ToSlash(rel), f, media.ContentType(p))
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't upload hls files: %w", err)
+	}
+
+	//only the manifest is set on the latest version so changes made while transcoding stay
+	//the uploaded files are collected by gc if the video went away meanwhile
+	manifestRef := cfg.mediaRef(prefix + media.MasterPlaylist)
+	_, err = cfg.db.ModifyVideo(ctx, payload.VideoID, func(video *database.Video) error {
+		if video.VideoURL == nil || *video.VideoURL != payload.VideoRef {
+			return errVideoReplaced
+		}
+		video.HLSURL = &manifestRef
+		return nil
+	})
+	if errors.Is(err, database.ErrNotFound) || errors.Is(err, errVideoReplaced) {
+		return nil
+	}
+	return err
+}
+
+func (cfg *apiConfig) downloadObject(ctx context.Context, key, dest string) error {
+	body, _, err := cfg.store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, body)
+	return err
+}
+
+// segmentURLResolver returns a function resolving the URLs of segments
+// stored under dir. A signing CDN signs one policy for all of dir, which
+// every segment URL then carries, instead of signing each segment.
+func (cfg *apiConfig) segmentURLResolver(ctx context.Context, dir string) func(key string) (string, error) {
+	if cfg.cdn == nil || !cfg.cdn.Signed() {
+		return func(key string) (string, error) {
+			return cfg.resolveMediaURL(ctx, cfg.mediaRef(key))
+		}
+	}
+	var signature string
+	return func(key string) (string, error) {
+		if signature != "" {
+			return cfg.cdn.ObjectURL(key) + "?" + signature, nil
+		}
+		signed, err := cfg.cdn.PrefixURL(dir+"/", key)
+		if err != nil {
+			return "", err
+		}
+		u, err := url.Parse(signed)
+		if err != nil {
+			return "", err
+		}
+		signature = u.RawQuery
+		return signed, nil
+	}
+}
+
+// hlsURLsNeedSigning reports whether HLS playlists have to go through
+// handlerHLSPlaylist, because segment URLs need signatures that relative
+// playlist entries can't carry.
+func (cfg *apiConfig) hlsURLsNeedSigning() bool {
+	if cfg.cdn != nil {
+		return cfg.cdn.Signed()
+	}
+	_, ok := cfg.store.(storage.Presigner)
+	return ok
+}
+
+func (cfg *apiConfig) resolveHLSURL(ctx context.Context, video database.Video) (string, error) {
+	if cfg.hlsURLsNeedSigning() {
+		playlistURL := "/api/videos/" + video.ID.String() + "/hls/" + media.MasterPlaylist
+		if video.IsPublic {
+			return playlistURL, nil
+		}
+		//players can't log in, private playlists need a token in the url
+		token, err := auth.MakePlaybackJWT(video.UserID, video.ID, cfg.jwtSecret, cfg.presignExpiry)
+		if err != nil {
+			return "", err
+		}
+		return playlistURL + "?token=" + url.QueryEscape(token), nil
+	}
+	return cfg.resolveMediaURL(ctx, *video.HLSURL)
+}
+
+// handlerHLSPlaylist serves a video's HLS playlists with every segment
+// replaced by a signed URL. Variant playlists stay relative so players
+// fetch them through here as well. Private videos are only served to their
+// owner, players prove that with the playback token in the URL.
+func (cfg *apiConfig) handlerHLSPlaylist(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getViewableVideoForRequest(w, r)
+	if !ok {
+		return
+	}
+	if video.HLSURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video has no HLS stream", nil)
+		return
+	}
+	manifestKey, ok := cfg.mediaKey(*video.HLSURL)
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Video has no HLS stream", nil)
+		return
+	}
+
+	file := r.PathValue("file")
+	if !fs.ValidPath(file) || path.Ext(file) != ".m3u8" {
+		respondWithError(w, http.StatusNotFound, "Playlist not found", nil)
+		return
+	}
+	playlistKey := path.Join(path.Dir(manifestKey), file)
+
+	body, _, err := cfg.store.Get(r.Context(), playlistKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Playlist not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return
+	}
+	defer body.Close()
+
+	segmentURL := cfg.segmentURLResolver(r.Context(), path.Dir(playlistKey))
+	var playlist strings.Builder
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case path.Ext(line) == ".m3u8":
+			//variant playlists come back through here, with the same playback token
+			if token := r.URL.Query().Get("token"); token != "" {
+				line += "?token=" + url.QueryEscape(token)
+			}
+		default:
+			line, err = segmentURL(path.Join(path.Dir(playlistKey), line))
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't sign segment url", err)
+				return
+			}
+		}
+		playlist.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read playlist", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", media.ContentType(file))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(playlist.String()))
+}
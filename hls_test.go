@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/cdn"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestHLSPlaylistSignsSegmentPrefix(t *testing.T) {
+	cfg, owner := newTestConfig(t)
+	ctx := context.Background()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.cdn, err = cdn.NewURLBuilder("d111111abcdef8.cloudfront.net", cdn.NewSigner("K2JCJMDEHXQW5F", key), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "hls", UserID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := "hls/" + video.ID.String() + "/abc"
+	playlist := "#EXTM3U\n#EXTINF:4.0,\n720p_000.ts\n#EXTINF:4.0,\n720p_001.ts\n#EXTINF:4.0,\n720p_002.ts\n"
+	if err := cfg.store.Put(ctx, dir+"/720p.m3u8", strings.NewReader(playlist), "application/vnd.apple.mpegurl"); err != nil {
+		t.Fatal(err)
+	}
+	manifestRef := cfg.mediaRef(dir + "/master.m3u8")
+	if _, err := cfg.db.ModifyVideo(ctx, video.ID, func(v *database.Video) error {
+		v.HLSURL = &manifestRef
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/videos/"+video.ID.String()+"/hls/720p.m3u8", nil)
+	r.SetPathValue("videoID", video.ID.String())
+	r.SetPathValue("file", "720p.m3u8")
+	authorize(t, cfg, r, owner)
+	w := httptest.NewRecorder()
+	cfg.handlerHLSPlaylist(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	//every segment carries the same policy, which covers the whole rendition
+	var signatures []string
+	for _, line := range strings.Split(strings.TrimSpace(w.Body.String()), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(u.Path, "/"+dir+"/720p_") {
+			t.Errorf("segment url %q isn't in the rendition's directory", line)
+		}
+		signatures = append(signatures, u.RawQuery)
+	}
+	if len(signatures) != 3 {
+		t.Fatalf("got %d segments, want 3", len(signatures))
+	}
+	for _, signature := range signatures[1:] {
+		if signature != signatures[0] {
+			t.Errorf("segments are signed separately: %q and %q", signatures[0], signature)
+		}
+	}
+
+	query, err := url.ParseQuery(signatures[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(query.Get("Policy"))
+	policyJSON, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var policy cdn.Policy
+	if err := json.Unmarshal(policyJSON, &policy); err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://d111111abcdef8.cloudfront.net/" + dir + "/*"; policy.Statement[0].Resource != want {
+		t.Errorf("policy resource = %q, want %q", policy.Statement[0].Resource, want)
+	}
+}
@@ -18,6 +18,12 @@ type TokenType string
 
 const (
 	TokenTypeAccess TokenType = "tubely-access"
+	// TokenTypeEvents tokens only let their holder watch one video's
+	// progress events.
+	TokenTypeEvents TokenType = "tubely-events"
+	// TokenTypePlayback tokens only let their holder fetch one video's
+	// HLS playlists.
+	TokenTypePlayback TokenType = "tubely-playback"
 )
 
 var ErrNoAuthHeaderIncluded = errors.New("no auth header included in request")
@@ -80,6 +86,66 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 	return id, nil
 }
 
+// MakeEventsJWT makes a token for watching the video's events. It's meant
+// for the URL of an EventSource, which can't send headers, so it can't be
+// used as an access token.
+func MakeEventsJWT(userID, videoID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return makeVideoJWT(TokenTypeEvents, userID, videoID, tokenSecret, expiresIn)
+}
+
+// ValidateEventsJWT returns the user an events token was made for, if it's
+// for the video.
+func ValidateEventsJWT(tokenString, tokenSecret string, videoID uuid.UUID) (uuid.UUID, error) {
+	return validateVideoJWT(TokenTypeEvents, tokenString, tokenSecret, videoID)
+}
+
+// MakePlaybackJWT makes a token for fetching a private video's HLS
+// playlists. Players request those without headers, so it goes in the URL.
+func MakePlaybackJWT(userID, videoID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return makeVideoJWT(TokenTypePlayback, userID, videoID, tokenSecret, expiresIn)
+}
+
+// ValidatePlaybackJWT returns the user a playback token was made for, if
+// it's for the video.
+func ValidatePlaybackJWT(tokenString, tokenSecret string, videoID uuid.UUID) (uuid.UUID, error) {
+	return validateVideoJWT(TokenTypePlayback, tokenString, tokenSecret, videoID)
+}
+
+func makeVideoJWT(tokenType TokenType, userID, videoID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    string(tokenType),
+		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+		Subject:   userID.String(),
+		Audience:  jwt.ClaimStrings{videoID.String()},
+	})
+	return token.SignedString([]byte(tokenSecret))
+}
+
+func validateVideoJWT(tokenType TokenType, tokenString, tokenSecret string, videoID uuid.UUID) (uuid.UUID, error) {
+	claimsStruct := jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(
+		tokenString,
+		&claimsStruct,
+		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
+		jwt.WithIssuer(string(tokenType)),
+		jwt.WithAudience(videoID.String()),
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	userIDString, err := token.Claims.GetSubject()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	id, err := uuid.Parse(userIDString)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+	return id, nil
+}
+
 func GetBearerToken(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEventsJWT(t *testing.T) {
+	userID, videoID := uuid.New(), uuid.New()
+	token, err := MakeEventsJWT(userID, videoID, "secret", time.Minute)
+	if err != nil {
+		t.Fatalf("MakeEventsJWT: %v", err)
+	}
+
+	got, err := ValidateEventsJWT(token, "secret", videoID)
+	if err != nil || got != userID {
+		t.Fatalf("ValidateEventsJWT = %v, %v, want %v", got, err, userID)
+	}
+	if _, err := ValidateEventsJWT(token, "secret", uuid.New()); err == nil {
+		t.Errorf("events token was accepted for another video")
+	}
+	if _, err := ValidateEventsJWT(token, "other-secret", videoID); err == nil {
+		t.Errorf("events token was accepted with the wrong secret")
+	}
+	if _, err := ValidateJWT(token, "secret"); err == nil {
+		t.Errorf("events token was accepted as an access token")
+	}
+	if _, err := ValidatePlaybackJWT(token, "secret", videoID); err == nil {
+		t.Errorf("events token was accepted as a playback token")
+	}
+
+	access, err := MakeJWT(userID, "secret", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateEventsJWT(access, "secret", videoID); err == nil {
+		t.Errorf("access token was accepted as an events token")
+	}
+
+	expired, err := MakeEventsJWT(userID, videoID, "secret", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateEventsJWT(expired, "secret", videoID); err == nil {
+		t.Errorf("expired events token was accepted")
+	}
+}
@@ -0,0 +1,191 @@
+package cdn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy is a CloudFront signed URL policy. A canned policy only sets
+// Resource and DateLessThan, custom policies may use wildcards in the
+// resource and add the other conditions.
+type Policy struct {
+	Statement []Statement `json:"Statement"`
+}
+
+type Statement struct {
+	Resource  string    `json:"Resource"`
+	Condition Condition `json:"Condition"`
+}
+
+type Condition struct {
+	DateLessThan    *EpochTime `json:"DateLessThan,omitempty"`
+	DateGreaterThan *EpochTime `json:"DateGreaterThan,omitempty"`
+	IPAddress       *SourceIP  `json:"IpAddress,omitempty"`
+}
+
+type EpochTime struct {
+	EpochTime int64 `json:"AWS:EpochTime"`
+}
+
+type SourceIP struct {
+	SourceIP string `json:"AWS:SourceIp"`
+}
+
+// NewCannedPolicy returns the policy CloudFront reconstructs for a URL
+// signed with only an Expires parameter.
+func NewCannedPolicy(resource string, expires time.Time) Policy {
+	return Policy{
+		Statement: []Statement{{
+			Resource: resource,
+			Condition: Condition{
+				DateLessThan: &EpochTime{EpochTime: expires.Unix()},
+			},
+		}},
+	}
+}
+
+// Encode returns the compact JSON form of the policy that gets signed.
+func (p Policy) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(p); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// Signer signs CloudFront URLs with the private half of a CloudFront key pair.
+type Signer struct {
+	keyPairID string
+	key       *rsa.PrivateKey
+}
+
+func NewSigner(keyPairID string, key *rsa.PrivateKey) *Signer {
+	return &Signer{
+		keyPairID: keyPairID,
+		key:       key,
+	}
+}
+
+// ParsePrivateKey reads an RSA private key from PEM encoded PKCS#1 or PKCS#8 data.
+func ParsePrivateKey(pemData []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("no PEM block found in private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// SignCanned signs rawURL with a canned policy that expires at expires.
+func (s *Signer) SignCanned(rawURL string, expires time.Time) (string, error) {
+	policy, err := NewCannedPolicy(rawURL, expires).Encode()
+	if err != nil {
+		return "", err
+	}
+	signature, err := s.sign(policy)
+	if err != nil {
+		return "", err
+	}
+	return appendQuery(rawURL, [][2]string{
+		{"Expires", strconv.FormatInt(expires.Unix(), 10)},
+		{"Signature", signature},
+		{"Key-Pair-Id", s.keyPairID},
+	})
+}
+
+// SignWithPolicy signs rawURL with a custom policy, which is sent along in
+// the URL.
+func (s *Signer) SignWithPolicy(rawURL string, policy Policy) (string, error) {
+	encoded, err := policy.Encode()
+	if err != nil {
+		return "", err
+	}
+	signature, err := s.sign(encoded)
+	if err != nil {
+		return "", err
+	}
+	return appendQuery(rawURL, [][2]string{
+		{"Policy", encodeBase64(encoded)},
+		{"Signature", signature},
+		{"Key-Pair-Id", s.keyPairID},
+	})
+}
+
+func (s *Signer) sign(policy []byte) (string, error) {
+	hash := sha1.Sum(policy)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA1, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("couldn't sign policy: %w", err)
+	}
+	return encodeBase64(sig), nil
+}
+
+// VerifySignature checks a URL-safe signature against a policy the same way
+// CloudFront does, using the public half of the key pair.
+func VerifySignature(pub *rsa.PublicKey, policy []byte, signature string) error {
+	sig, err := decodeBase64(signature)
+	if err != nil {
+		return fmt.Errorf("couldn't decode signature: %w", err)
+	}
+	hash := sha1.Sum(policy)
+	return rsa.VerifyPKCS1v15(pub, crypto.SHA1, hash[:], sig)
+}
+
+// DecodePolicy reverses the URL-safe encoding of a custom policy parameter.
+func DecodePolicy(encoded string) ([]byte, error) {
+	return decodeBase64(encoded)
+}
+
+// CloudFront uses base64 with +, = and / replaced by -, _ and ~.
+var urlSafeReplacer = strings.NewReplacer("+", "-", "=", "_", "/", "~")
+var urlSafeReverser = strings.NewReplacer("-", "+", "_", "=", "~", "/")
+
+func encodeBase64(data []byte) string {
+	return urlSafeReplacer.Replace(base64.StdEncoding.EncodeToString(data))
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(urlSafeReverser.Replace(s))
+}
+
+func appendQuery(rawURL string, params [][2]string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	// the signed values are already URL safe, keep them in the given order
+	parts := make([]string, 0, len(params))
+	for _, p := range params {
+		parts = append(parts, p[0]+"="+p[1])
+	}
+	if u.RawQuery != "" {
+		u.RawQuery += "&"
+	}
+	u.RawQuery += strings.Join(parts, "&")
+	return u.String(), nil
+}
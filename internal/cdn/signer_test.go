@@ -0,0 +1,162 @@
+package cdn
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSigner(t *testing.T) (*Signer, *rsa.PublicKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSigner("K2JCJMDEHXQW5F", key), &key.PublicKey
+}
+
+func TestSignCanned(t *testing.T) {
+	signer, pub := newTestSigner(t)
+	resource := "https://d111111abcdef8.cloudfront.net/landscape/a.mp4"
+	expires := time.Unix(1767225600, 0)
+
+	signed, err := signer.SignCanned(resource, expires)
+	if err != nil {
+		t.Fatalf("SignCanned: %v", err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if got := query.Get("Expires"); got != strconv.FormatInt(expires.Unix(), 10) {
+		t.Errorf("Expires = %q, want %d", got, expires.Unix())
+	}
+	if got := query.Get("Key-Pair-Id"); got != "K2JCJMDEHXQW5F" {
+		t.Errorf("Key-Pair-Id = %q", got)
+	}
+	if query.Has("Policy") {
+		t.Errorf("canned URL carries a Policy parameter")
+	}
+
+	//CloudFront rebuilds the canned policy from the URL and the Expires value
+	policy, err := NewCannedPolicy(resource, expires).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySignature(pub, policy, query.Get("Signature")); err != nil {
+		t.Errorf("signature doesn't verify: %v", err)
+	}
+	want := `{"Statement":[{"Resource":"` + resource + `","Condition":{"DateLessThan":{"AWS:EpochTime":1767225600}}}]}`
+	if string(policy) != want {
+		t.Errorf("canned policy = %s, want %s", policy, want)
+	}
+
+	other, err := NewCannedPolicy(resource+"?x=1", expires).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if VerifySignature(pub, other, query.Get("Signature")) == nil {
+		t.Errorf("signature verifies against a different resource")
+	}
+}
+
+func TestSignWithPolicy(t *testing.T) {
+	signer, pub := newTestSigner(t)
+	policy := Policy{Statement: []Statement{{
+		Resource: "https://d111111abcdef8.cloudfront.net/hls/*",
+		Condition: Condition{
+			DateLessThan:    &EpochTime{EpochTime: 1767225600},
+			DateGreaterThan: &EpochTime{EpochTime: 1767222000},
+			IPAddress:       &SourceIP{SourceIP: "192.0.2.0/24"},
+		},
+	}}}
+
+	signed, err := signer.SignWithPolicy("https://d111111abcdef8.cloudfront.net/hls/v/master.m3u8?a=b", policy)
+	if err != nil {
+		t.Fatalf("SignWithPolicy: %v", err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("a") != "b" {
+		t.Errorf("existing query parameter was lost: %s", u.RawQuery)
+	}
+	if query.Has("Expires") {
+		t.Errorf("custom policy URL carries an Expires parameter")
+	}
+
+	decoded, err := DecodePolicy(query.Get("Policy"))
+	if err != nil {
+		t.Fatalf("DecodePolicy: %v", err)
+	}
+	var roundTripped Policy
+	if err := json.Unmarshal(decoded, &roundTripped); err != nil {
+		t.Fatalf("decoded policy isn't JSON: %v", err)
+	}
+	statement := roundTripped.Statement[0]
+	if statement.Resource != policy.Statement[0].Resource ||
+		statement.Condition.IPAddress == nil || statement.Condition.IPAddress.SourceIP != "192.0.2.0/24" ||
+		statement.Condition.DateGreaterThan == nil || statement.Condition.DateGreaterThan.EpochTime != 1767222000 {
+		t.Errorf("decoded policy = %s", decoded)
+	}
+
+	if err := VerifySignature(pub, decoded, query.Get("Signature")); err != nil {
+		t.Errorf("signature doesn't verify: %v", err)
+	}
+	if VerifySignature(pub, append(decoded, ' '), query.Get("Signature")) == nil {
+		t.Errorf("signature verifies against a modified policy")
+	}
+}
+
+func TestSignaturesAreURLSafe(t *testing.T) {
+	signer, _ := newTestSigner(t)
+	for i := 0; i < 20; i++ {
+		signed, err := signer.SignCanned("https://example.cloudfront.net/a.mp4", time.Unix(int64(1767225600+i), 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		//the raw value has to survive in a URL without escaping
+		_, raw, _ := strings.Cut(signed, "Signature=")
+		signature, _, _ := strings.Cut(raw, "&")
+		if strings.ContainsAny(signature, "+/=%") {
+			t.Fatalf("signature isn't URL safe: %s", signature)
+		}
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, block := range map[string]*pem.Block{
+		"pkcs1": {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)},
+		"pkcs8": {Type: "PRIVATE KEY", Bytes: pkcs8},
+	} {
+		parsed, err := ParsePrivateKey(pem.EncodeToMemory(block))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !parsed.Equal(key) {
+			t.Errorf("%s: parsed a different key", name)
+		}
+	}
+	if _, err := ParsePrivateKey([]byte("not a key")); err == nil {
+		t.Errorf("parsed garbage without an error")
+	}
+}
@@ -0,0 +1,75 @@
+package cdn
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// URLBuilder turns object keys into URLs on a CloudFront distribution,
+// signing them when a Signer is configured.
+type URLBuilder struct {
+	baseURL *url.URL
+	signer  *Signer
+	expiry  time.Duration
+	now     func() time.Time
+}
+
+// NewURLBuilder accepts either the distribution's domain name or a full base
+// URL. signer may be nil for distributions serving public content.
+func NewURLBuilder(distribution string, signer *Signer, expiry time.Duration) (*URLBuilder, error) {
+	if !strings.Contains(distribution, "://") {
+		distribution = "https://" + distribution
+	}
+	base, err := url.Parse(strings.TrimSuffix(distribution, "/"))
+	if err != nil {
+		return nil, err
+	}
+	return &URLBuilder{
+		baseURL: base,
+		signer:  signer,
+		expiry:  expiry,
+		now:     time.Now,
+	}, nil
+}
+
+// Signed reports whether the builder signs the URLs it returns.
+func (b *URLBuilder) Signed() bool {
+	return b.signer != nil
+}
+
+// URL returns the distribution URL for key, signed with a canned policy if
+// the builder has a signer.
+func (b *URLBuilder) URL(key string) (string, error) {
+	u := b.ObjectURL(key)
+	if b.signer == nil {
+		return u, nil
+	}
+	return b.signer.SignCanned(u, b.now().Add(b.expiry))
+}
+
+// PrefixURL signs a custom policy covering every object under prefix and
+// returns it together with the URL for key. It lets a client fetch related
+// objects, like HLS segments, with one set of signature parameters.
+func (b *URLBuilder) PrefixURL(prefix, key string) (string, error) {
+	u := b.ObjectURL(key)
+	if b.signer == nil {
+		return u, nil
+	}
+	policy := Policy{
+		Statement: []Statement{{
+			Resource: b.ObjectURL(prefix) + "*",
+			Condition: Condition{
+				DateLessThan: &EpochTime{EpochTime: b.now().Add(b.expiry).Unix()},
+			},
+		}},
+	}
+	return b.signer.SignWithPolicy(u, policy)
+}
+
+// ObjectURL returns the unsigned distribution URL for key.
+func (b *URLBuilder) ObjectURL(key string) string {
+	u := *b.baseURL
+	u.Path = u.Path + "/" + key
+	return u.String()
+}
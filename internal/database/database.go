@@ -1,89 +1,83 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Client runs queries against a SQLite or Postgres database, or against a
+// transaction on one.
 type Client struct {
-	db *sql.DB
+	db      *sql.DB
+	q       querier
+	dialect dialect
 }
 
-func NewClient(pathToDB string) (Client, error) {
-	db, err := sql.Open("sqlite3", pathToDB)
+// ErrNoFTS5 is returned for SQLite databases when the driver was built
+// without the sqlite_fts5 tag. Video search needs SQLite's FTS5 module.
+var ErrNoFTS5 = errors.New("SQLite was built without FTS5, build with -tags sqlite_fts5 (make build)")
+
+// Open connects to the database without touching its schema. The DSN's
+// scheme picks the database: postgres:// or postgresql:// for Postgres,
+// anything else is a SQLite path.
+func Open(dsn string) (Client, error) {
+	d, driverName, source, err := parseDSN(dsn)
 	if err != nil {
 		return Client{}, err
 	}
-	c := Client{db}
-	err = c.autoMigrate()
+	db, err := sql.Open(driverName, source)
 	if err != nil {
 		return Client{}, err
 	}
+	c := Client{db: db, q: db, dialect: d}
+	if err := c.checkFTS5(context.Background()); err != nil {
+		db.Close()
+		return Client{}, err
+	}
 	return c, nil
-
 }
 
-func (c *Client) autoMigrate() error {
-	userTable := `
-	CREATE TABLE IF NOT EXISTS users (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		password TEXT NOT NULL,
-		email TEXT UNIQUE NOT NULL
-	);
-	`
-	_, err := c.db.Exec(userTable)
-	if err != nil {
-		return err
+// checkFTS5 refuses SQLite libraries without FTS5 up front, rather than
+// when a migration or a search first needs it.
+func (c Client) checkFTS5(ctx context.Context) error {
+	if c.dialect != dialectSQLite {
+		return nil
 	}
-	refreshTokenTable := `
-	CREATE TABLE IF NOT EXISTS refresh_tokens (
-		token TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		revoked_at TIMESTAMP,
-		user_id TEXT NOT NULL,
-		expires_at TIMESTAMP NOT NULL,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(refreshTokenTable)
-	if err != nil {
+	var fts5 bool
+	if err := c.queryRow(ctx, `SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5); err != nil {
 		return err
 	}
-
-	videoTable := `
-	CREATE TABLE IF NOT EXISTS videos (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		title TEXT NOT NULL,
-		description TEXT,
-		thumbnail_url TEXT,
-		video_url TEXT TEXT,
-		user_id INTEGER,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(videoTable)
-	if err != nil {
-		return err
+	if !fts5 {
+		return ErrNoFTS5
 	}
 	return nil
 }
 
-func (c Client) Reset() error {
-	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
-		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
+// NewClient connects to the database and applies any pending migrations.
+func NewClient(dsn string) (Client, error) {
+	c, err := Open(dsn)
+	if err != nil {
+		return Client{}, err
 	}
-	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
-		return fmt.Errorf("failed to reset table users: %w", err)
+	_, err = c.MigrateUp(context.Background())
+	if err != nil {
+		return Client{}, err
 	}
-	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
-		return fmt.Errorf("failed to reset table videos: %w", err)
+	return c, nil
+}
+
+func (c Client) Reset(ctx context.Context) error {
+	//children first, Postgres enforces the foreign keys
+	tables := []string{"refresh_tokens", "storage_deletions", "jobs", "upload_sessions", "videos", "users"}
+	for _, table := range tables {
+		if _, err := c.exec(ctx, "DELETE FROM "+table); err != nil {
+			return fmt.Errorf("failed to reset table %s: %w", table, err)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialect is the SQL flavour of the database behind a Client. Queries are
+// written for SQLite with ? placeholders and rebound for Postgres.
+type dialect string
+
+const (
+	dialectSQLite   dialect = "sqlite"
+	dialectPostgres dialect = "postgres"
+)
+
+// parseDSN picks the dialect from the DSN's scheme. postgres:// and
+// postgresql:// URLs go to Postgres, sqlite:// URLs, file: URIs and plain
+// paths to SQLite.
+func parseDSN(dsn string) (d dialect, driverName, source string, err error) {
+	scheme, rest, found := strings.Cut(dsn, "://")
+	switch {
+	case !found:
+		return dialectSQLite, "sqlite3", sqliteSource(dsn), nil
+	case scheme == "postgres" || scheme == "postgresql":
+		return dialectPostgres, "postgres", dsn, nil
+	case scheme == "sqlite" || scheme == "sqlite3":
+		return dialectSQLite, "sqlite3", sqliteSource(rest), nil
+	default:
+		return "", "", "", fmt.Errorf("unsupported database scheme %q, expected postgres or sqlite", scheme)
+	}
+}
+
+// sqliteSource makes transactions take the write lock when they begin and
+// wait for it instead of failing, unless the DSN says otherwise. Otherwise
+// two transactions that read a row and then update it fail with "database
+// is locked" when they run at the same time.
+func sqliteSource(source string) string {
+	for _, param := range []string{"_txlock=immediate", "_busy_timeout=5000"} {
+		name, _, _ := strings.Cut(param, "=")
+		if strings.Contains(source, name+"=") {
+			continue
+		}
+		if strings.Contains(source, "?") {
+			source += "&" + param
+		} else {
+			source += "?" + param
+		}
+	}
+	return source
+}
+
+// rebind turns ? placeholders into the dialect's own. Question marks inside
+// quoted strings are left alone.
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	inString := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inString = !inString
+		case r == '?' && !inString:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// querier is what *sql.DB and *sql.Tx have in common.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (c Client) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return c.q.ExecContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c Client) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return c.q.QueryContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c Client) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return c.q.QueryRowContext(ctx, c.dialect.rebind(query), args...)
+}
+
+// timeParam formats t for comparison with a timestamp column. SQLite
+// stores timestamps as text and compares them as strings, so t has to be
+// in the format the column was written in: CURRENT_TIMESTAMP's, with the
+// microseconds now adds when there are any.
+func (c Client) timeParam(t time.Time) any {
+	if c.dialect == dialectSQLite {
+		return t.UTC().Format("2006-01-02 15:04:05.999999")
+	}
+	return t
+}
+
+// now is the current time for setting timestamps that have to change on
+// every write, which CURRENT_TIMESTAMP's whole seconds don't.
+func (c Client) now() any {
+	return c.timeParam(time.Now().Truncate(time.Microsecond))
+}
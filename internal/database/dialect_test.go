@@ -0,0 +1,92 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDSN(t *testing.T) {
+	tests := []struct {
+		dsn     string
+		dialect dialect
+		driver  string
+		source  string
+	}{
+		{"tubely.db", dialectSQLite, "sqlite3", "tubely.db?_txlock=immediate&_busy_timeout=5000"},
+		{"sqlite:///tmp/t.db", dialectSQLite, "sqlite3", "/tmp/t.db?_txlock=immediate&_busy_timeout=5000"},
+		{"file:t.db?mode=memory", dialectSQLite, "sqlite3", "file:t.db?mode=memory&_txlock=immediate&_busy_timeout=5000"},
+		{"sqlite://t.db?_txlock=deferred", dialectSQLite, "sqlite3", "t.db?_txlock=deferred&_busy_timeout=5000"},
+		{"postgres://u:p@localhost/db", dialectPostgres, "postgres", "postgres://u:p@localhost/db"},
+		{"postgresql://localhost/db", dialectPostgres, "postgres", "postgresql://localhost/db"},
+	}
+	for _, tt := range tests {
+		d, driver, source, err := parseDSN(tt.dsn)
+		if err != nil {
+			t.Errorf("parseDSN(%q): %v", tt.dsn, err)
+			continue
+		}
+		if d != tt.dialect || driver != tt.driver || source != tt.source {
+			t.Errorf("parseDSN(%q) = %s, %s, %s, want %s, %s, %s", tt.dsn, d, driver, source, tt.dialect, tt.driver, tt.source)
+		}
+	}
+	if _, _, _, err := parseDSN("mysql://localhost/db"); err == nil {
+		t.Errorf("parseDSN accepted a mysql DSN")
+	}
+}
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`SELECT * FROM videos WHERE id = ?`, `SELECT * FROM videos WHERE id = $1`},
+		{`UPDATE videos SET title = ?, description = ? WHERE id = ?`, `UPDATE videos SET title = $1, description = $2 WHERE id = $3`},
+		{`SELECT '?' FROM videos WHERE id = ? AND title = 'what?'`, `SELECT '?' FROM videos WHERE id = $1 AND title = 'what?'`},
+		{`SELECT 'it''s?' WHERE a = ?`, `SELECT 'it''s?' WHERE a = $1`},
+		{`SELECT 1`, `SELECT 1`},
+	}
+	for _, tt := range tests {
+		if got := dialectPostgres.rebind(tt.query); got != tt.want {
+			t.Errorf("rebind(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+		if got := dialectSQLite.rebind(tt.query); got != tt.query {
+			t.Errorf("SQLite rebind changed %q to %q", tt.query, got)
+		}
+	}
+}
+
+func TestTimeParam(t *testing.T) {
+	ts := time.Date(2026, 10, 17, 3, 4, 5, 123456789, time.FixedZone("x", 2*60*60))
+
+	sqlite := Client{dialect: dialectSQLite}
+	if got := sqlite.timeParam(ts); got != "2026-10-17 01:04:05.123456" {
+		t.Errorf("SQLite timeParam = %v", got)
+	}
+	if got := sqlite.timeParam(ts.Truncate(time.Second)); got != "2026-10-17 01:04:05" {
+		t.Errorf("SQLite timeParam of whole seconds = %v, want CURRENT_TIMESTAMP's format", got)
+	}
+
+	postgres := Client{dialect: dialectPostgres}
+	if got, ok := postgres.timeParam(ts).(time.Time); !ok || !got.Equal(ts) {
+		t.Errorf("Postgres timeParam = %v, want the time as is", postgres.timeParam(ts))
+	}
+}
+
+func TestSkipLocked(t *testing.T) {
+	if got := (Client{dialect: dialectPostgres}).skipLocked(); got != " FOR UPDATE SKIP LOCKED" {
+		t.Errorf("Postgres skipLocked = %q", got)
+	}
+	if got := (Client{dialect: dialectSQLite}).skipLocked(); got != "" {
+		t.Errorf("SQLite skipLocked = %q", got)
+	}
+}
+
+func TestSearchQuery(t *testing.T) {
+	terms := []string{`pasta`, `it's`, `"quoted"`, `back\slash`}
+	if got := (Client{dialect: dialectPostgres}).searchQuery(terms); got != `'pasta':* & 'it''s':* & '"quoted"':* & 'back\\slash':*` {
+		t.Errorf("Postgres searchQuery = %s", got)
+	}
+	if got := (Client{dialect: dialectSQLite}).searchQuery(terms); got != `"pasta"* "it's"* """quoted"""* "back\slash"*` {
+		t.Errorf("SQLite searchQuery = %s", got)
+	}
+}
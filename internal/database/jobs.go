@@ -0,0 +1,318 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type JobStatus string
+
+const (
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusSucceeded JobStatus = "succeeded"
+	// JobStatusDead is the dead letter state of jobs that ran out of
+	// attempts or failed permanently.
+	JobStatusDead JobStatus = "dead"
+)
+
+// DefaultJobMaxAttempts is used when a job is enqueued without MaxAttempts.
+const DefaultJobMaxAttempts = 5
+
+// ErrJobLeaseLost is returned when a worker reports on a job whose lease
+// expired and was claimed by someone else.
+var ErrJobLeaseLost = errors.New("job lease lost")
+
+type Job struct {
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	Status         JobStatus  `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastError      *string    `json:"last_error"`
+	RunAt          time.Time  `json:"run_at"`
+	LeaseOwner     *string    `json:"-"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at"`
+	EnqueueJobParams
+}
+
+type EnqueueJobParams struct {
+	Type        string     `json:"type"`
+	Payload     string     `json:"payload"`
+	UserID      *uuid.UUID `json:"user_id"`
+	MaxAttempts int        `json:"max_attempts"`
+}
+
+const jobColumns = `
+		id,
+		created_at,
+		updated_at,
+		type,
+		payload,
+		user_id,
+		status,
+		attempts,
+		max_attempts,
+		last_error,
+		run_at,
+		lease_owner,
+		lease_expires_at
+`
+
+func scanJob(row interface{ Scan(...any) error }) (Job, error) {
+	var job Job
+	err := row.Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.Type,
+		&job.Payload,
+		&job.UserID,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.LastError,
+		&job.RunAt,
+		&job.LeaseOwner,
+		&job.LeaseExpiresAt,
+	)
+	return job, err
+}
+
+func (c Client) EnqueueJob(ctx context.Context, params EnqueueJobParams) (Job, error) {
+	id := uuid.New()
+	if params.MaxAttempts <= 0 {
+		params.MaxAttempts = DefaultJobMaxAttempts
+	}
+	query := `
+	INSERT INTO jobs (
+		id,
+		created_at,
+		updated_at,
+		type,
+		payload,
+		user_id,
+		status,
+		attempts,
+		max_attempts,
+		run_at
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, 0, ?, ?)
+	RETURNING` + jobColumns
+	job, err := scanJob(c.queryRow(ctx, query, id, params.Type, params.Payload, params.UserID, JobStatusQueued, params.MaxAttempts, time.Now().UTC()))
+	if err != nil {
+		return Job{}, err
+	}
+	return job, nil
+}
+
+func (c Client) GetJob(ctx context.Context, id uuid.UUID) (Job, error) {
+	query := `SELECT` + jobColumns + `FROM jobs WHERE id = ?`
+	job, err := scanJob(c.queryRow(ctx, query, id))
+	if err != nil {
+		return Job{}, notFound(err)
+	}
+	return job, nil
+}
+
+// GetJobsForUser returns the user's jobs, newest first. An empty status
+// returns jobs in every state.
+func (c Client) GetJobsForUser(ctx context.Context, userID uuid.UUID, status JobStatus) ([]Job, error) {
+	query := `SELECT` + jobColumns + `FROM jobs WHERE user_id = ?`
+	args := []any{userID}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := c.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// errLeaseExpired is recorded on jobs dead lettered because their worker
+// stopped during the last attempt.
+const errLeaseExpired = "lease expired on the last attempt"
+
+// ClaimJob leases the oldest due job to owner until the lease runs out and
+// returns it, or nil if there is nothing to do. Running jobs whose lease
+// expired are claimed again, so work isn't lost when a worker dies, unless
+// that was their last attempt: those are dead lettered instead.
+func (c Client) ClaimJob(ctx context.Context, owner string, lease time.Duration) (*Job, error) {
+	var claimed *Job
+	err := c.WithTx(ctx, func(tx Client) error {
+		now := time.Now().UTC()
+		_, err := tx.exec(ctx, `
+		UPDATE jobs
+		SET
+			status = ?,
+			last_error = ?,
+			lease_owner = NULL,
+			lease_expires_at = NULL,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE status = ? AND lease_expires_at <= ? AND attempts >= max_attempts
+		`, JobStatusDead, errLeaseExpired, JobStatusRunning, now)
+		if err != nil {
+			return err
+		}
+
+		query := `
+		UPDATE jobs
+		SET
+			status = ?,
+			attempts = attempts + 1,
+			lease_owner = ?,
+			lease_expires_at = ?,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE (status = ? AND run_at <= ?)
+				OR (status = ? AND lease_expires_at <= ? AND attempts < max_attempts)
+			ORDER BY run_at
+			LIMIT 1` + tx.skipLocked() + `
+		)
+		RETURNING` + jobColumns
+
+		job, err := scanJob(tx.queryRow(ctx, query,
+			JobStatusRunning, owner, now.Add(lease),
+			JobStatusQueued, now,
+			JobStatusRunning, now,
+		))
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		claimed = &job
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// ExtendJobLease keeps a long running job from being claimed again.
+func (c Client) ExtendJobLease(ctx context.Context, id uuid.UUID, owner string, lease time.Duration) error {
+	query := `
+	UPDATE jobs
+	SET
+		lease_expires_at = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status = ? AND lease_owner = ?
+	`
+	res, err := c.exec(ctx, query, time.Now().UTC().Add(lease), id, JobStatusRunning, owner)
+	return leaseResult(res, err)
+}
+
+func (c Client) CompleteJob(ctx context.Context, id uuid.UUID, owner string) error {
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		last_error = NULL,
+		lease_owner = NULL,
+		lease_expires_at = NULL,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status = ? AND lease_owner = ?
+	`
+	res, err := c.exec(ctx, query, JobStatusSucceeded, id, JobStatusRunning, owner)
+	return leaseResult(res, err)
+}
+
+// RetryJob puts a failed job back in the queue to run again at runAt.
+func (c Client) RetryJob(ctx context.Context, id uuid.UUID, owner, jobErr string, runAt time.Time) error {
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		last_error = ?,
+		run_at = ?,
+		lease_owner = NULL,
+		lease_expires_at = NULL,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status = ? AND lease_owner = ?
+	`
+	res, err := c.exec(ctx, query, JobStatusQueued, jobErr, runAt.UTC(), id, JobStatusRunning, owner)
+	return leaseResult(res, err)
+}
+
+// DeadLetterJob moves a failed job to the dead letter state, where it stays
+// until it is requeued by hand.
+func (c Client) DeadLetterJob(ctx context.Context, id uuid.UUID, owner, jobErr string) error {
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		last_error = ?,
+		lease_owner = NULL,
+		lease_expires_at = NULL,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status = ? AND lease_owner = ?
+	`
+	res, err := c.exec(ctx, query, JobStatusDead, jobErr, id, JobStatusRunning, owner)
+	return leaseResult(res, err)
+}
+
+// RequeueDeadJob gives a dead lettered job a fresh set of attempts. It
+// returns false if the job isn't dead.
+func (c Client) RequeueDeadJob(ctx context.Context, id uuid.UUID) (bool, error) {
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		attempts = 0,
+		run_at = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status = ?
+	`
+	res, err := c.exec(ctx, query, JobStatusQueued, time.Now().UTC(), id, JobStatusDead)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func leaseResult(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobLeaseLost
+	}
+	return nil
+}
+
+// skipLocked keeps concurrent Postgres workers from waiting on the same
+// job. SQLite only has one writer at a time anyway.
+func (c Client) skipLocked() string {
+	if c.dialect == dialectPostgres {
+		return " FOR UPDATE SKIP LOCKED"
+	}
+	return ""
+}
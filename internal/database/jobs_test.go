@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJobLifecycle(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		userID := createTestUser(t, c)
+		job, err := c.EnqueueJob(ctx, EnqueueJobParams{Type: "process_video", Payload: `{}`, UserID: &userID})
+		if err != nil {
+			t.Fatalf("EnqueueJob: %v", err)
+		}
+		if job.Status != JobStatusQueued || job.MaxAttempts != DefaultJobMaxAttempts {
+			t.Errorf("enqueued job is %s with %d attempts", job.Status, job.MaxAttempts)
+		}
+
+		claimed, err := c.ClaimJob(ctx, "worker-1", time.Minute)
+		if err != nil || claimed == nil {
+			t.Fatalf("ClaimJob = %v, %v", claimed, err)
+		}
+		if claimed.ID != job.ID || claimed.Status != JobStatusRunning || claimed.Attempts != 1 {
+			t.Errorf("claimed %+v", claimed)
+		}
+		if again, err := c.ClaimJob(ctx, "worker-2", time.Minute); err != nil || again != nil {
+			t.Errorf("claimed a leased job again: %v, %v", again, err)
+		}
+
+		if err := c.ExtendJobLease(ctx, job.ID, "worker-2", time.Minute); !errors.Is(err, ErrJobLeaseLost) {
+			t.Errorf("extending someone else's lease: %v, want ErrJobLeaseLost", err)
+		}
+		if err := c.RetryJob(ctx, job.ID, "worker-1", "try again", time.Now().Add(-time.Second)); err != nil {
+			t.Fatalf("RetryJob: %v", err)
+		}
+
+		claimed, err = c.ClaimJob(ctx, "worker-2", time.Minute)
+		if err != nil || claimed == nil {
+			t.Fatalf("ClaimJob after a retry = %v, %v", claimed, err)
+		}
+		if claimed.Attempts != 2 || claimed.LastError == nil || *claimed.LastError != "try again" {
+			t.Errorf("retried job %+v", claimed)
+		}
+		if err := c.CompleteJob(ctx, job.ID, "worker-2"); err != nil {
+			t.Fatalf("CompleteJob: %v", err)
+		}
+
+		jobs, err := c.GetJobsForUser(ctx, userID, JobStatusSucceeded)
+		if err != nil || len(jobs) != 1 {
+			t.Errorf("GetJobsForUser = %d jobs: %v", len(jobs), err)
+		}
+	})
+}
+
+func TestJobRetryIsNotDueEarly(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		job, err := c.EnqueueJob(ctx, EnqueueJobParams{Type: "t", Payload: `{}`})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.ClaimJob(ctx, "worker", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.RetryJob(ctx, job.ID, "worker", "later", time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if claimed, err := c.ClaimJob(ctx, "worker", time.Minute); err != nil || claimed != nil {
+			t.Errorf("claimed a job retrying in an hour: %v, %v", claimed, err)
+		}
+	})
+}
+
+func TestJobExpiredLeaseIsReclaimed(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		job, err := c.EnqueueJob(ctx, EnqueueJobParams{Type: "t", Payload: `{}`})
+		if err != nil {
+			t.Fatal(err)
+		}
+		//a lease that already ran out, as if the worker died
+		if _, err := c.ClaimJob(ctx, "dead-worker", -time.Second); err != nil {
+			t.Fatal(err)
+		}
+
+		claimed, err := c.ClaimJob(ctx, "worker", time.Minute)
+		if err != nil || claimed == nil || claimed.ID != job.ID {
+			t.Fatalf("ClaimJob of an expired lease = %v, %v", claimed, err)
+		}
+		if err := c.CompleteJob(ctx, job.ID, "dead-worker"); !errors.Is(err, ErrJobLeaseLost) {
+			t.Errorf("completing a lost job: %v, want ErrJobLeaseLost", err)
+		}
+	})
+}
+
+func TestDeadLetterJob(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		job, err := c.EnqueueJob(ctx, EnqueueJobParams{Type: "t", Payload: `{}`, MaxAttempts: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.ClaimJob(ctx, "worker", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.DeadLetterJob(ctx, job.ID, "worker", "broken"); err != nil {
+			t.Fatalf("DeadLetterJob: %v", err)
+		}
+		if claimed, err := c.ClaimJob(ctx, "worker", time.Minute); err != nil || claimed != nil {
+			t.Errorf("claimed a dead job: %v, %v", claimed, err)
+		}
+
+		requeued, err := c.RequeueDeadJob(ctx, job.ID)
+		if err != nil || !requeued {
+			t.Fatalf("RequeueDeadJob = %v, %v", requeued, err)
+		}
+		if requeued, err := c.RequeueDeadJob(ctx, job.ID); err != nil || requeued {
+			t.Errorf("requeued a queued job: %v, %v", requeued, err)
+		}
+		got, err := c.GetJob(ctx, job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != JobStatusQueued || got.Attempts != 0 {
+			t.Errorf("requeued job is %s after %d attempts", got.Status, got.Attempts)
+		}
+	})
+}
+
+func TestJobExpiredLeaseOnLastAttemptIsDeadLettered(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		job, err := c.EnqueueJob(ctx, EnqueueJobParams{Type: "t", Payload: `{}`, MaxAttempts: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		//the worker dies during both attempts
+		for attempt := 1; attempt <= 2; attempt++ {
+			claimed, err := c.ClaimJob(ctx, "dying-worker", -time.Second)
+			if err != nil || claimed == nil || claimed.Attempts != attempt {
+				t.Fatalf("attempt %d: ClaimJob = %v, %v", attempt, claimed, err)
+			}
+		}
+
+		if claimed, err := c.ClaimJob(ctx, "worker", time.Minute); err != nil || claimed != nil {
+			t.Fatalf("claimed a job that ran out of attempts: %+v, %v", claimed, err)
+		}
+		got, err := c.GetJob(ctx, job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != JobStatusDead || got.Attempts != 2 || got.LeaseOwner != nil {
+			t.Errorf("job is %s after %d attempts, leased to %v", got.Status, got.Attempts, got.LeaseOwner)
+		}
+		if got.LastError == nil || *got.LastError != errLeaseExpired {
+			t.Errorf("last error = %v", got.LastError)
+		}
+	})
+}
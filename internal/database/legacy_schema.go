@@ -0,0 +1,200 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// upgradeLegacySchema brings a database created by the old autoMigrate,
+// before versioned migrations, up to the shape of the initial migration.
+// Every statement is idempotent, so it works whichever version of
+// autoMigrate created the tables.
+func (c *Client) upgradeLegacySchema(ctx context.Context) error {
+	userTable := `
+	CREATE TABLE IF NOT EXISTS users (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		password TEXT NOT NULL,
+		email TEXT UNIQUE NOT NULL
+	);
+	`
+	_, err := c.exec(ctx, userTable)
+	if err != nil {
+		return err
+	}
+	refreshTokenTable := `
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		token TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		revoked_at TIMESTAMP,
+		user_id TEXT NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.exec(ctx, refreshTokenTable)
+	if err != nil {
+		return err
+	}
+
+	videoTable := `
+	CREATE TABLE IF NOT EXISTS videos (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		title TEXT NOT NULL,
+		description TEXT,
+		thumbnail_url TEXT,
+		video_url TEXT TEXT,
+		user_id INTEGER,
+		width INTEGER,
+		height INTEGER,
+		duration REAL,
+		codec TEXT,
+		thumbnail_renditions TEXT,
+		hls_manifest_url TEXT,
+		status TEXT NOT NULL DEFAULT 'draft',
+		failure_reason TEXT,
+		upload_started_at TIMESTAMP,
+		processing_started_at TIMESTAMP,
+		ready_at TIMESTAMP,
+		failed_at TIMESTAMP,
+		deleted_at TIMESTAMP,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.exec(ctx, videoTable)
+	if err != nil {
+		return err
+	}
+
+	storageDeletionTable := `
+	CREATE TABLE IF NOT EXISTS storage_deletions (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		ref TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		run_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS storage_deletions_run_at ON storage_deletions(run_at);
+	`
+	_, err = c.exec(ctx, storageDeletionTable)
+	if err != nil {
+		return err
+	}
+
+	uploadSessionTable := `
+	CREATE TABLE IF NOT EXISTS upload_sessions (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		upload_offset INTEGER NOT NULL DEFAULT 0,
+		staging_path TEXT NOT NULL,
+		completed_at TIMESTAMP,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.exec(ctx, uploadSessionTable)
+	if err != nil {
+		return err
+	}
+
+	jobTable := `
+	CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		type TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		user_id TEXT,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		run_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS jobs_status_run_at ON jobs(status, run_at);
+	`
+	_, err = c.exec(ctx, jobTable)
+	if err != nil {
+		return err
+	}
+
+	//columns added after the tables were first created
+	addedColumns := []struct {
+		table      string
+		name       string
+		definition string
+	}{
+		{"videos", "width", "INTEGER"},
+		{"videos", "height", "INTEGER"},
+		{"videos", "duration", "REAL"},
+		{"videos", "codec", "TEXT"},
+		{"videos", "thumbnail_renditions", "TEXT"},
+		{"videos", "hls_manifest_url", "TEXT"},
+		{"videos", "status", "TEXT NOT NULL DEFAULT 'draft'"},
+		{"videos", "failure_reason", "TEXT"},
+		{"videos", "upload_started_at", "TIMESTAMP"},
+		{"videos", "processing_started_at", "TIMESTAMP"},
+		{"videos", "ready_at", "TIMESTAMP"},
+		{"videos", "failed_at", "TIMESTAMP"},
+		{"videos", "deleted_at", "TIMESTAMP"},
+		{"jobs", "max_attempts", "INTEGER NOT NULL DEFAULT 5"},
+		{"jobs", "lease_owner", "TEXT"},
+		{"jobs", "lease_expires_at", "TIMESTAMP"},
+	}
+	for _, col := range addedColumns {
+		err = c.addColumnIfMissing(ctx, col.table, col.name, col.definition)
+		if err != nil {
+			return err
+		}
+	}
+
+	//videos uploaded before statuses existed are ready
+	_, err = c.exec(ctx, "UPDATE videos SET status = ? WHERE status = ? AND video_url IS NOT NULL", VideoStatusReady, VideoStatusDraft)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Client) addColumnIfMissing(ctx context.Context, table, column, definition string) error {
+	rows, err := c.query(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = c.exec(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations live in migrations/<dialect>/ as <version>_<name>.up.sql and
+// <version>_<name>.down.sql. Versions are applied in order, each in its own
+// transaction together with its row in schema_migrations. Both dialects
+// keep the same versions so a schema change is one version everywhere.
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// legacyVersion is the migration matching the schema autoMigrate created.
+const legacyVersion = 1
+
+func loadMigrations(d dialect) ([]Migration, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/"+string(d)+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, file := range files {
+		base := path.Base(file)
+		name, direction, ok := strings.Cut(strings.TrimSuffix(base, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", base)
+		}
+		versionString, name, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(versionString)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s must start with a version number", base)
+		}
+
+		data, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d needs both an up and a down file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// prepareMigrations creates schema_migrations if needed. A database created
+// by autoMigrate is upgraded to the initial migration and recorded as
+// having it.
+func (c Client) prepareMigrations(ctx context.Context) error {
+	exists, err := c.tableExists(ctx, "schema_migrations")
+	if err != nil || exists {
+		return err
+	}
+	//only SQLite databases were ever created by autoMigrate
+	legacy := false
+	if c.dialect == dialectSQLite {
+		legacy, err = c.tableExists(ctx, "videos")
+		if err != nil {
+			return err
+		}
+	}
+	if legacy {
+		if err := c.upgradeLegacySchema(ctx); err != nil {
+			return fmt.Errorf("couldn't upgrade legacy schema: %w", err)
+		}
+	}
+
+	_, err = c.exec(ctx, `
+	CREATE TABLE schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)
+	`)
+	if err != nil {
+		return err
+	}
+	if legacy {
+		_, err = c.exec(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			legacyVersion, "initial", time.Now().UTC())
+	}
+	return err
+}
+
+func (c Client) tableExists(ctx context.Context, name string) (bool, error) {
+	query := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`
+	if c.dialect == dialectPostgres {
+		query = `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?`
+	}
+	var count int
+	err := c.queryRow(ctx, query, name).Scan(&count)
+	return count > 0, err
+}
+
+func (c Client) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := c.query(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// MigrateUp applies all pending migrations and returns the ones it applied.
+func (c Client) MigrateUp(ctx context.Context) ([]Migration, error) {
+	if err := c.prepareMigrations(ctx); err != nil {
+		return nil, err
+	}
+	migrations, err := loadMigrations(c.dialect)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := c.runMigration(ctx, m.Up, func(tx Client) error {
+			_, err := tx.exec(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+				m.Version, m.Name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s failed: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// MigrateDown rolls back the last steps applied migrations and returns the
+// ones it rolled back.
+func (c Client) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	if err := c.prepareMigrations(ctx); err != nil {
+		return nil, err
+	}
+	migrations, err := loadMigrations(c.dialect)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		err := c.runMigration(ctx, m.Down, func(tx Client) error {
+			_, err := tx.exec(ctx, `DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("rolling back migration %d_%s failed: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// MigrationStatus lists every known migration and when it was applied.
+func (c Client) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	if err := c.prepareMigrations(ctx); err != nil {
+		return nil, err
+	}
+	migrations, err := loadMigrations(c.dialect)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := applied[m.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// runMigration executes a migration's statements and the bookkeeping in
+// record in one transaction.
+func (c Client) runMigration(ctx context.Context, statements string, record func(tx Client) error) error {
+	return c.WithTx(ctx, func(tx Client) error {
+		//executed as is, migrations are written in their dialect
+		if _, err := tx.q.ExecContext(ctx, statements); err != nil {
+			return err
+		}
+		return record(tx)
+	})
+}
@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		migrations, err := loadMigrations(c.dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		statuses, err := c.MigrationStatus(ctx)
+		if err != nil {
+			t.Fatalf("MigrationStatus: %v", err)
+		}
+		if len(statuses) != len(migrations) {
+			t.Fatalf("got %d statuses for %d migrations", len(statuses), len(migrations))
+		}
+		for _, status := range statuses {
+			if status.AppliedAt == nil {
+				t.Errorf("migration %d_%s wasn't applied", status.Version, status.Name)
+			}
+		}
+
+		//every down migration has to undo its up migration
+		down, err := c.MigrateDown(ctx, len(migrations))
+		if err != nil {
+			t.Fatalf("MigrateDown: %v", err)
+		}
+		if len(down) != len(migrations) {
+			t.Fatalf("rolled back %d of %d migrations", len(down), len(migrations))
+		}
+		for _, table := range []string{"users", "videos", "jobs"} {
+			exists, err := c.tableExists(ctx, table)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exists {
+				t.Errorf("table %s is still there after rolling back every migration", table)
+			}
+		}
+
+		up, err := c.MigrateUp(ctx)
+		if err != nil {
+			t.Fatalf("MigrateUp after rolling back: %v", err)
+		}
+		if len(up) != len(migrations) {
+			t.Fatalf("applied %d of %d migrations", len(up), len(migrations))
+		}
+		up, err = c.MigrateUp(ctx)
+		if err != nil || len(up) != 0 {
+			t.Fatalf("second MigrateUp applied %d migrations: %v", len(up), err)
+		}
+	})
+}
+
+func TestMigrationsRoundTripWithData(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		userID := createTestUser(t, c)
+		createTestVideo(t, c, CreateVideoParams{Title: "kept", UserID: userID, Tags: Tags{"a"}})
+
+		//rolling back past the search migrations and reapplying them keeps videos searchable
+		if _, err := c.MigrateDown(ctx, 3); err != nil {
+			t.Fatalf("MigrateDown: %v", err)
+		}
+		if _, err := c.MigrateUp(ctx); err != nil {
+			t.Fatalf("MigrateUp: %v", err)
+		}
+		page, err := c.SearchVideos(ctx, SearchVideosParams{UserID: userID, Query: "kept"})
+		if err != nil {
+			t.Fatalf("SearchVideos: %v", err)
+		}
+		if len(page.Results) != 1 {
+			t.Errorf("found %d videos, want the one created before the migrations ran", len(page.Results))
+		}
+	})
+}
+
+func TestSQLiteSearchIndexIsRebuilt(t *testing.T) {
+	c := newTestClient(t, "sqlite://"+t.TempDir()+"/test.db")
+	ctx := context.Background()
+	userID := createTestUser(t, c)
+
+	//builds without FTS5 used to leave the index and its triggers out
+	for _, statement := range []string{
+		`DROP TRIGGER videos_fts_update`,
+		`DROP TRIGGER videos_fts_delete`,
+		`DROP TRIGGER videos_fts_insert`,
+		`DROP TABLE videos_fts`,
+		`DELETE FROM schema_migrations WHERE version = 6`,
+	} {
+		if _, err := c.exec(ctx, statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	createTestVideo(t, c, CreateVideoParams{Title: "missed", UserID: userID})
+
+	if _, err := c.MigrateUp(ctx); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	createTestVideo(t, c, CreateVideoParams{Title: "indexed", UserID: userID})
+	for _, query := range []string{"missed", "indexed"} {
+		page, err := c.SearchVideos(ctx, SearchVideosParams{UserID: userID, Query: query})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Results) != 1 {
+			t.Errorf("search for %q found %d videos, want 1", query, len(page.Results))
+		}
+	}
+}
+
+func TestTableExists(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		if _, err := c.exec(ctx, `CREATE TABLE probe (id INTEGER)`); err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range map[string]bool{"probe": true, "videos": true, "missing": false} {
+			exists, err := c.tableExists(ctx, name)
+			if err != nil {
+				t.Fatalf("tableExists(%q): %v", name, err)
+			}
+			if exists != want {
+				t.Errorf("tableExists(%q) = %v, want %v", name, exists, want)
+			}
+		}
+	})
+}
+
+func TestLegacySchemaIsBaselined(t *testing.T) {
+	ctx := context.Background()
+	dsn := "sqlite://" + t.TempDir() + "/legacy.db"
+	legacy, err := Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the tables autoMigrate used to create, without schema_migrations
+	if err := legacy.upgradeLegacySchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+	legacy.db.Close()
+
+	c := newTestClient(t, dsn)
+	statuses, err := c.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Errorf("migration %d_%s wasn't applied to the legacy database", status.Version, status.Name)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+CREATE TABLE users (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	password TEXT NOT NULL,
+	email TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE refresh_tokens (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMPTZ,
+	user_id UUID NOT NULL REFERENCES users(id),
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE videos (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT,
+	user_id UUID REFERENCES users(id),
+	width INTEGER,
+	height INTEGER,
+	duration DOUBLE PRECISION,
+	codec TEXT,
+	thumbnail_renditions TEXT,
+	hls_manifest_url TEXT,
+	status TEXT NOT NULL DEFAULT 'draft',
+	failure_reason TEXT,
+	upload_started_at TIMESTAMPTZ,
+	processing_started_at TIMESTAMPTZ,
+	ready_at TIMESTAMPTZ,
+	failed_at TIMESTAMPTZ,
+	deleted_at TIMESTAMPTZ
+);
+
+CREATE TABLE storage_deletions (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	ref TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	run_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX storage_deletions_run_at ON storage_deletions(run_at);
+
+CREATE TABLE upload_sessions (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	video_id UUID NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	user_id UUID NOT NULL,
+	size BIGINT NOT NULL,
+	upload_offset BIGINT NOT NULL DEFAULT 0,
+	staging_path TEXT NOT NULL,
+	completed_at TIMESTAMPTZ
+);
+
+CREATE TABLE jobs (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	type TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	user_id UUID,
+	status TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL DEFAULT 5,
+	last_error TEXT,
+	run_at TIMESTAMPTZ NOT NULL,
+	lease_owner TEXT,
+	lease_expires_at TIMESTAMPTZ
+);
+CREATE INDEX jobs_status_run_at ON jobs(status, run_at);
@@ -0,0 +1 @@
+DROP INDEX videos_user_id_created_at;
@@ -0,0 +1,3 @@
+-- The column types fixed by this version in SQLite were created correctly
+-- here, only the index is new.
+CREATE INDEX videos_user_id_created_at ON videos(user_id, created_at);
@@ -0,0 +1,6 @@
+DROP INDEX videos_user_id_duration;
+DROP INDEX videos_user_id_title;
+DROP INDEX videos_user_id_updated_at;
+
+DROP INDEX videos_search_vector;
+ALTER TABLE videos DROP COLUMN search_vector;
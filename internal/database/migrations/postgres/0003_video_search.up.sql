@@ -0,0 +1,13 @@
+-- Postgres searches a generated tsvector instead of an FTS5 table. The
+-- simple configuration doesn't stem, matching SQLite's tokenizer.
+ALTER TABLE videos ADD COLUMN search_vector tsvector
+	GENERATED ALWAYS AS (
+		to_tsvector('simple', title || ' ' || COALESCE(description, ''))
+	) STORED;
+
+CREATE INDEX videos_search_vector ON videos USING GIN (search_vector);
+
+-- Keyset pagination for the other sort orders.
+CREATE INDEX videos_user_id_updated_at ON videos(user_id, updated_at);
+CREATE INDEX videos_user_id_title ON videos(user_id, title);
+CREATE INDEX videos_user_id_duration ON videos(user_id, (COALESCE(duration, -1)));
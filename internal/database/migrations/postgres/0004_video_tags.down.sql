@@ -0,0 +1,12 @@
+DROP INDEX videos_is_public_created_at;
+
+DROP INDEX videos_search_vector;
+ALTER TABLE videos DROP COLUMN search_vector;
+ALTER TABLE videos ADD COLUMN search_vector tsvector
+	GENERATED ALWAYS AS (
+		to_tsvector('simple', title || ' ' || COALESCE(description, ''))
+	) STORED;
+CREATE INDEX videos_search_vector ON videos USING GIN (search_vector);
+
+ALTER TABLE videos DROP COLUMN is_public;
+ALTER TABLE videos DROP COLUMN tags;
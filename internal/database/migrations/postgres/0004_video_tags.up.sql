@@ -0,0 +1,17 @@
+-- tags is a JSON array of strings, like thumbnail_renditions.
+ALTER TABLE videos ADD COLUMN tags TEXT;
+ALTER TABLE videos ADD COLUMN is_public BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- The search vector gains the tags, and weights so ranking prefers matches
+-- in the title, then the tags, then the description.
+DROP INDEX videos_search_vector;
+ALTER TABLE videos DROP COLUMN search_vector;
+ALTER TABLE videos ADD COLUMN search_vector tsvector
+	GENERATED ALWAYS AS (
+		setweight(to_tsvector('simple', title), 'A') ||
+		setweight(to_tsvector('simple', COALESCE(tags, '')), 'B') ||
+		setweight(to_tsvector('simple', COALESCE(description, '')), 'C')
+	) STORED;
+CREATE INDEX videos_search_vector ON videos USING GIN (search_vector);
+
+CREATE INDEX videos_is_public_created_at ON videos(is_public, created_at);
@@ -0,0 +1,2 @@
+-- Only SQLite databases could end up without their search index.
+SELECT 1;
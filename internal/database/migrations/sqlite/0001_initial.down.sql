@@ -0,0 +1,6 @@
+DROP TABLE jobs;
+DROP TABLE upload_sessions;
+DROP TABLE storage_deletions;
+DROP TABLE videos;
+DROP TABLE refresh_tokens;
+DROP TABLE users;
@@ -0,0 +1,84 @@
+-- The schema as it was created by autoMigrate before versioned migrations.
+CREATE TABLE users (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	password TEXT NOT NULL,
+	email TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE refresh_tokens (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE videos (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT TEXT,
+	user_id INTEGER,
+	width INTEGER,
+	height INTEGER,
+	duration REAL,
+	codec TEXT,
+	thumbnail_renditions TEXT,
+	hls_manifest_url TEXT,
+	status TEXT NOT NULL DEFAULT 'draft',
+	failure_reason TEXT,
+	upload_started_at TIMESTAMP,
+	processing_started_at TIMESTAMP,
+	ready_at TIMESTAMP,
+	failed_at TIMESTAMP,
+	deleted_at TIMESTAMP,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE storage_deletions (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	ref TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	run_at TIMESTAMP NOT NULL
+);
+CREATE INDEX storage_deletions_run_at ON storage_deletions(run_at);
+
+CREATE TABLE upload_sessions (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	video_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	upload_offset INTEGER NOT NULL DEFAULT 0,
+	staging_path TEXT NOT NULL,
+	completed_at TIMESTAMP,
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+
+CREATE TABLE jobs (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	type TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	user_id TEXT,
+	status TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL DEFAULT 5,
+	last_error TEXT,
+	run_at TIMESTAMP NOT NULL,
+	lease_owner TEXT,
+	lease_expires_at TIMESTAMP
+);
+CREATE INDEX jobs_status_run_at ON jobs(status, run_at);
@@ -0,0 +1,34 @@
+CREATE TABLE videos_old (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT TEXT,
+	user_id INTEGER,
+	width INTEGER,
+	height INTEGER,
+	duration REAL,
+	codec TEXT,
+	thumbnail_renditions TEXT,
+	hls_manifest_url TEXT,
+	status TEXT NOT NULL DEFAULT 'draft',
+	failure_reason TEXT,
+	upload_started_at TIMESTAMP,
+	processing_started_at TIMESTAMP,
+	ready_at TIMESTAMP,
+	failed_at TIMESTAMP,
+	deleted_at TIMESTAMP,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+INSERT INTO videos_old SELECT
+	id, created_at, updated_at, title, description, thumbnail_url, video_url,
+	user_id, width, height, duration, codec, thumbnail_renditions,
+	hls_manifest_url, status, failure_reason, upload_started_at,
+	processing_started_at, ready_at, failed_at, deleted_at
+FROM videos;
+
+DROP TABLE videos;
+ALTER TABLE videos_old RENAME TO videos;
@@ -0,0 +1,45 @@
+-- video_url was declared as "TEXT TEXT" and user_id as INTEGER although it
+-- holds the TEXT id of a user. SQLite can't change column types, so the
+-- table is rebuilt.
+CREATE TABLE videos_new (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT,
+	user_id TEXT,
+	width INTEGER,
+	height INTEGER,
+	duration REAL,
+	codec TEXT,
+	thumbnail_renditions TEXT,
+	hls_manifest_url TEXT,
+	status TEXT NOT NULL DEFAULT 'draft',
+	failure_reason TEXT,
+	upload_started_at TIMESTAMP,
+	processing_started_at TIMESTAMP,
+	ready_at TIMESTAMP,
+	failed_at TIMESTAMP,
+	deleted_at TIMESTAMP,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+INSERT INTO videos_new (
+	id, created_at, updated_at, title, description, thumbnail_url, video_url,
+	user_id, width, height, duration, codec, thumbnail_renditions,
+	hls_manifest_url, status, failure_reason, upload_started_at,
+	processing_started_at, ready_at, failed_at, deleted_at
+)
+SELECT
+	id, created_at, updated_at, title, description, thumbnail_url, video_url,
+	CAST(user_id AS TEXT), width, height, duration, codec, thumbnail_renditions,
+	hls_manifest_url, status, failure_reason, upload_started_at,
+	processing_started_at, ready_at, failed_at, deleted_at
+FROM videos;
+
+DROP TABLE videos;
+ALTER TABLE videos_new RENAME TO videos;
+
+CREATE INDEX videos_user_id_created_at ON videos(user_id, created_at);
@@ -0,0 +1,8 @@
+DROP INDEX videos_user_id_duration;
+DROP INDEX videos_user_id_title;
+DROP INDEX videos_user_id_updated_at;
+
+DROP TRIGGER videos_fts_update;
+DROP TRIGGER videos_fts_delete;
+DROP TRIGGER videos_fts_insert;
+DROP TABLE videos_fts;
@@ -0,0 +1,33 @@
+-- Full-text index over video titles and descriptions. It keeps its own copy
+-- of the text keyed by video id rather than pointing at videos' rowid,
+-- which VACUUM is free to renumber.
+CREATE VIRTUAL TABLE videos_fts USING fts5(
+	video_id UNINDEXED,
+	title,
+	description
+);
+
+INSERT INTO videos_fts (video_id, title, description)
+SELECT id, title, COALESCE(description, '') FROM videos;
+
+CREATE TRIGGER videos_fts_insert AFTER INSERT ON videos BEGIN
+	INSERT INTO videos_fts (video_id, title, description)
+	VALUES (new.id, new.title, COALESCE(new.description, ''));
+END;
+
+CREATE TRIGGER videos_fts_delete AFTER DELETE ON videos BEGIN
+	DELETE FROM videos_fts WHERE video_id = old.id;
+END;
+
+CREATE TRIGGER videos_fts_update AFTER UPDATE OF title, description ON videos
+WHEN old.title IS NOT new.title OR old.description IS NOT new.description
+BEGIN
+	UPDATE videos_fts
+	SET title = new.title, description = COALESCE(new.description, '')
+	WHERE video_id = old.id;
+END;
+
+-- Keyset pagination for the other sort orders.
+CREATE INDEX videos_user_id_updated_at ON videos(user_id, updated_at);
+CREATE INDEX videos_user_id_title ON videos(user_id, title);
+CREATE INDEX videos_user_id_duration ON videos(user_id, COALESCE(duration, -1));
@@ -0,0 +1,46 @@
+-- tags is a JSON array of strings, like thumbnail_renditions.
+ALTER TABLE videos ADD COLUMN tags TEXT;
+ALTER TABLE videos ADD COLUMN is_public BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- The search index gains the tags, and prefix indexes so prefix queries
+-- don't have to scan every term.
+DROP TRIGGER videos_fts_update;
+DROP TRIGGER videos_fts_delete;
+DROP TRIGGER videos_fts_insert;
+DROP TABLE videos_fts;
+
+CREATE VIRTUAL TABLE videos_fts USING fts5(
+	video_id UNINDEXED,
+	title,
+	description,
+	tags,
+	tokenize = 'unicode61 remove_diacritics 2',
+	prefix = '2 3'
+);
+
+INSERT INTO videos_fts (video_id, title, description, tags)
+SELECT id, title, COALESCE(description, ''), COALESCE(tags, '') FROM videos;
+
+CREATE TRIGGER videos_fts_insert AFTER INSERT ON videos BEGIN
+	INSERT INTO videos_fts (video_id, title, description, tags)
+	VALUES (new.id, new.title, COALESCE(new.description, ''), COALESCE(new.tags, ''));
+END;
+
+CREATE TRIGGER videos_fts_delete AFTER DELETE ON videos BEGIN
+	DELETE FROM videos_fts WHERE video_id = old.id;
+END;
+
+CREATE TRIGGER videos_fts_update AFTER UPDATE OF title, description, tags ON videos
+WHEN old.title IS NOT new.title
+	OR old.description IS NOT new.description
+	OR old.tags IS NOT new.tags
+BEGIN
+	UPDATE videos_fts
+	SET
+		title = new.title,
+		description = COALESCE(new.description, ''),
+		tags = COALESCE(new.tags, '')
+	WHERE video_id = old.id;
+END;
+
+CREATE INDEX videos_is_public_created_at ON videos(is_public, created_at);
@@ -0,0 +1,3 @@
+-- version is bumped by every change to a video, so updates can check
+-- nothing else changed the row since it was read.
+ALTER TABLE videos ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
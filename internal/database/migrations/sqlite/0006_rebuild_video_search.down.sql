@@ -0,0 +1,2 @@
+-- The rebuilt index is the one 0004 creates, it stays for 0004 to drop.
+SELECT 1;
@@ -0,0 +1,41 @@
+-- Builds without FTS5 used to skip the full-text index and drop its
+-- triggers, so databases they opened may be missing them. The index is
+-- recreated as 0004 defines it and filled from the videos table.
+DROP TRIGGER IF EXISTS videos_fts_update;
+DROP TRIGGER IF EXISTS videos_fts_delete;
+DROP TRIGGER IF EXISTS videos_fts_insert;
+DROP TABLE IF EXISTS videos_fts;
+
+CREATE VIRTUAL TABLE videos_fts USING fts5(
+	video_id UNINDEXED,
+	title,
+	description,
+	tags,
+	tokenize = 'unicode61 remove_diacritics 2',
+	prefix = '2 3'
+);
+
+INSERT INTO videos_fts (video_id, title, description, tags)
+SELECT id, title, COALESCE(description, ''), COALESCE(tags, '') FROM videos;
+
+CREATE TRIGGER videos_fts_insert AFTER INSERT ON videos BEGIN
+	INSERT INTO videos_fts (video_id, title, description, tags)
+	VALUES (new.id, new.title, COALESCE(new.description, ''), COALESCE(new.tags, ''));
+END;
+
+CREATE TRIGGER videos_fts_delete AFTER DELETE ON videos BEGIN
+	DELETE FROM videos_fts WHERE video_id = old.id;
+END;
+
+CREATE TRIGGER videos_fts_update AFTER UPDATE OF title, description, tags ON videos
+WHEN old.title IS NOT new.title
+	OR old.description IS NOT new.description
+	OR old.tags IS NOT new.tags
+BEGIN
+	UPDATE videos_fts
+	SET
+		title = new.title,
+		description = COALESCE(new.description, ''),
+		tags = COALESCE(new.tags, '')
+	WHERE video_id = old.id;
+END;
@@ -1,7 +1,7 @@
 package database
 
 import (
-	"database/sql"
+	"context"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,7 +20,7 @@ type CreateRefreshTokenParams struct {
 	ExpiresAt time.Time `json:"expires_at"`
 }
 
-func (c Client) CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToken, error) {
+func (c Client) CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) (RefreshToken, error) {
 	query := `
 		INSERT INTO refresh_tokens (
 			token,
@@ -30,25 +30,32 @@ func (c Client) CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToke
 			expires_at
 		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
 	`
-	_, err := c.db.Exec(query, params.Token, params.UserID.String(), params.ExpiresAt)
+	var token RefreshToken
+	err := c.WithTx(ctx, func(tx Client) error {
+		_, err := tx.exec(ctx, query, params.Token, params.UserID.String(), params.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		token, err = tx.GetRefreshToken(ctx, params.Token)
+		return err
+	})
 	if err != nil {
 		return RefreshToken{}, err
 	}
-
-	return c.GetRefreshToken(params.Token)
+	return token, nil
 }
 
-func (c Client) RevokeRefreshToken(token string) error {
+func (c Client) RevokeRefreshToken(ctx context.Context, token string) error {
 	query := `
 		UPDATE refresh_tokens
 		SET revoked_at = CURRENT_TIMESTAMP
 		WHERE token = ?
 	`
-	_, err := c.db.Exec(query, token)
+	_, err := c.exec(ctx, query, token)
 	return err
 }
 
-func (c Client) GetRefreshToken(token string) (RefreshToken, error) {
+func (c Client) GetRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
 	query := `
 		SELECT token, created_at, updated_at, user_id, expires_at, revoked_at
 		FROM refresh_tokens
@@ -56,13 +63,10 @@ func (c Client) GetRefreshToken(token string) (RefreshToken, error) {
 	`
 	var rt RefreshToken
 	var userID string
-	err := c.db.QueryRow(query, token).
+	err := c.queryRow(ctx, query, token).
 		Scan(&rt.Token, &rt.CreatedAt, &rt.UpdatedAt, &userID, &rt.ExpiresAt, &rt.RevokedAt)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return RefreshToken{}, nil
-		}
-		return RefreshToken{}, err
+		return RefreshToken{}, notFound(err)
 	}
 
 	rt.UserID, err = uuid.Parse(userID)
@@ -73,11 +77,11 @@ func (c Client) GetRefreshToken(token string) (RefreshToken, error) {
 	return rt, nil
 }
 
-func (c Client) DeleteRefreshToken(token string) error {
+func (c Client) DeleteRefreshToken(ctx context.Context, token string) error {
 	query := `
 		DELETE FROM refresh_tokens
 		WHERE token = ?
 	`
-	_, err := c.db.Exec(query, token)
+	_, err := c.exec(ctx, query, token)
 	return err
 }
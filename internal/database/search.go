@@ -0,0 +1,214 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// SearchScope is whose videos SearchVideos looks through.
+type SearchScope string
+
+const (
+	SearchScopeMine   SearchScope = "mine"
+	SearchScopePublic SearchScope = "public"
+)
+
+// HighlightStart and HighlightEnd surround the matched words in search
+// highlights. They're private use characters so they can't be confused with
+// anything in the text.
+const (
+	HighlightStart = "\ue000"
+	HighlightEnd   = "\ue001"
+)
+
+const (
+	DefaultSearchPageSize = 20
+	MaxSearchPageSize     = 100
+)
+
+type SearchVideosParams struct {
+	// UserID is the searching user, whose videos the mine scope covers.
+	UserID uuid.UUID
+	Scope  SearchScope
+	// Query matches videos with words starting with each of its words.
+	Query  string
+	Limit  int
+	Offset int
+}
+
+type SearchResult struct {
+	Video Video `json:"video"`
+	// Rank orders results, higher is more relevant. It's only comparable
+	// within one search.
+	Rank float64 `json:"rank"`
+	// TitleHighlight is the whole title with the matches marked.
+	TitleHighlight string `json:"title_highlight"`
+	// DescriptionSnippet is the part of the description with the most
+	// matches, marked.
+	DescriptionSnippet string `json:"description_snippet"`
+}
+
+type SearchPage struct {
+	Results []SearchResult
+	// NextOffset is the offset of the next page, 0 on the last page.
+	NextOffset int
+}
+
+// SearchVideos returns a page of the videos in the scope matching the
+// query, most relevant first. Matches in the title count most, then tags,
+// then the description. Videos in the trash are never found.
+func (c Client) SearchVideos(ctx context.Context, params SearchVideosParams) (SearchPage, error) {
+	page := SearchPage{Results: []SearchResult{}}
+	terms := strings.Fields(params.Query)
+	if len(terms) == 0 {
+		return page, nil
+	}
+	limit := params.Limit
+	if limit <= 0 {
+		limit = DefaultSearchPageSize
+	}
+	limit = min(limit, MaxSearchPageSize)
+
+	scope := `videos.user_id = ?`
+	scopeArg := any(params.UserID)
+	if params.Scope == SearchScopePublic {
+		scope = `videos.is_public = ?`
+		scopeArg = true
+	}
+
+	var query string
+	var args []any
+	if c.dialect == dialectPostgres {
+		headline := `StartSel=` + HighlightStart + `, StopSel=` + HighlightEnd
+		query = `
+		SELECT` + videoColumns + `,
+			ts_rank(videos.search_vector, q) AS relevance,
+			ts_headline('simple', videos.title, q, ?),
+			ts_headline('simple', COALESCE(videos.description, ''), q, ?)
+		FROM videos, to_tsquery('simple', ?) q
+		WHERE videos.search_vector @@ q AND videos.deleted_at IS NULL AND ` + scope + `
+		ORDER BY relevance DESC, videos.id
+		LIMIT ? OFFSET ?`
+		args = []any{
+			headline + `, HighlightAll=true`,
+			headline + `, MaxWords=30, MinWords=10`,
+			c.searchQuery(terms),
+			scopeArg, limit + 1, params.Offset,
+		}
+	} else {
+		//bm25 weighs the columns video_id, title, description, tags and is
+		//lower for better matches
+		query = `
+		SELECT` + videoColumns + `,
+			-bm25(videos_fts, 0, 10, 2, 5) AS relevance,
+			highlight(videos_fts, 1, ?, ?),
+			snippet(videos_fts, 2, ?, ?, '…', 24)
+		FROM videos_fts
+		JOIN videos ON videos.id = videos_fts.video_id
+		WHERE videos_fts MATCH ? AND videos.deleted_at IS NULL AND ` + scope + `
+		ORDER BY relevance DESC, videos.id
+		LIMIT ? OFFSET ?`
+		args = []any{
+			HighlightStart, HighlightEnd,
+			HighlightStart, HighlightEnd,
+			c.searchQuery(terms),
+			scopeArg, limit + 1, params.Offset,
+		}
+	}
+
+	//one extra row tells whether there's another page
+	rows, err := c.query(ctx, query, args...)
+	if err != nil {
+		return SearchPage{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result SearchResult
+		video, err := scanVideo(scanExtra(rows, &result.Rank, &result.TitleHighlight, &result.DescriptionSnippet))
+		if err != nil {
+			return SearchPage{}, err
+		}
+		result.Video = video
+		page.Results = append(page.Results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return SearchPage{}, err
+	}
+
+	if len(page.Results) > limit {
+		page.Results = page.Results[:limit]
+		page.NextOffset = params.Offset + limit
+	}
+	return page, nil
+}
+
+// RebuildSearchIndex rebuilds the search index from the videos table, in
+// case it got out of sync with it.
+func (c Client) RebuildSearchIndex(ctx context.Context) error {
+	if c.dialect == dialectPostgres {
+		//the search vector is a generated column, only the index can drift
+		_, err := c.exec(ctx, `REINDEX INDEX videos_search_vector`)
+		return err
+	}
+	return c.WithTx(ctx, func(tx Client) error {
+		_, err := tx.exec(ctx, `DELETE FROM videos_fts`)
+		if err != nil {
+			return err
+		}
+		_, err = tx.exec(ctx, `
+		INSERT INTO videos_fts (video_id, title, description, tags)
+		SELECT id, title, COALESCE(description, ''), COALESCE(tags, '') FROM videos
+		`)
+		if err != nil {
+			return err
+		}
+		_, err = tx.exec(ctx, `INSERT INTO videos_fts (videos_fts) VALUES ('optimize')`)
+		return err
+	})
+}
+
+// videoMatchClause is the condition matching videos against searchQuery's
+// result.
+func (c Client) videoMatchClause() string {
+	if c.dialect == dialectPostgres {
+		return `videos.search_vector @@ to_tsquery('simple', ?)`
+	}
+	return `videos.id IN (SELECT video_id FROM videos_fts WHERE videos_fts MATCH ?)`
+}
+
+// searchQuery turns the words a user searched for into a query matching
+// words that start with every one of them. Each word is quoted so nothing
+// the user types is read as query syntax.
+func (c Client) searchQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		if c.dialect == dialectPostgres {
+			term = strings.NewReplacer(`'`, `''`, `\`, `\\`).Replace(term)
+			quoted[i] = `'` + term + `':*`
+		} else {
+			quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+		}
+	}
+	if c.dialect == dialectPostgres {
+		return strings.Join(quoted, " & ")
+	}
+	return strings.Join(quoted, " ")
+}
+
+// extraScanner scans a row's first columns with the wrapped scan function
+// and its remaining ones into extra.
+type extraScanner struct {
+	row   interface{ Scan(...any) error }
+	extra []any
+}
+
+func scanExtra(row interface{ Scan(...any) error }, extra ...any) extraScanner {
+	return extraScanner{row: row, extra: extra}
+}
+
+func (s extraScanner) Scan(dest ...any) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
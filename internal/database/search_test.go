@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSearchVideos(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		userID := createTestUser(t, c)
+		other := createTestUser(t, c)
+		inDescription := createTestVideo(t, c, CreateVideoParams{Title: "Dinner", Description: "we make pasta from scratch", UserID: userID})
+		inTitle := createTestVideo(t, c, CreateVideoParams{Title: "Pasta night", UserID: userID})
+		createTestVideo(t, c, CreateVideoParams{Title: "Pasta for everyone", UserID: other, IsPublic: true})
+		createTestVideo(t, c, CreateVideoParams{Title: "Secret pasta", UserID: other})
+		trashed := createTestVideo(t, c, CreateVideoParams{Title: "Old pasta", UserID: userID})
+		if err := c.TrashVideo(ctx, trashed.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		page, err := c.SearchVideos(ctx, SearchVideosParams{UserID: userID, Query: "past"})
+		if err != nil {
+			t.Fatalf("SearchVideos: %v", err)
+		}
+		if len(page.Results) != 2 {
+			t.Fatalf("found %d of the user's videos, want 2", len(page.Results))
+		}
+		if page.Results[0].Video.ID != inTitle.ID || page.Results[1].Video.ID != inDescription.ID {
+			t.Errorf("a title match should rank above a description match: %q, %q", page.Results[0].Video.Title, page.Results[1].Video.Title)
+		}
+		if want := HighlightStart + "Pasta" + HighlightEnd + " night"; page.Results[0].TitleHighlight != want {
+			t.Errorf("title highlight = %q, want %q", page.Results[0].TitleHighlight, want)
+		}
+		if !strings.Contains(page.Results[1].DescriptionSnippet, HighlightStart+"pasta"+HighlightEnd) {
+			t.Errorf("description snippet = %q", page.Results[1].DescriptionSnippet)
+		}
+
+		public, err := c.SearchVideos(ctx, SearchVideosParams{UserID: userID, Scope: SearchScopePublic, Query: "pasta"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(public.Results) != 1 || public.Results[0].Video.Title != "Pasta for everyone" {
+			t.Errorf("public search found %d videos", len(public.Results))
+		}
+
+		first, err := c.SearchVideos(ctx, SearchVideosParams{UserID: userID, Query: "pasta", Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(first.Results) != 1 || first.NextOffset != 1 {
+			t.Errorf("first page has %d results and next offset %d", len(first.Results), first.NextOffset)
+		}
+	})
+}
+
+func TestSearchFollowsUpdates(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		userID := createTestUser(t, c)
+		video := createTestVideo(t, c, CreateVideoParams{Title: "before", UserID: userID})
+
+		if _, err := c.ModifyVideo(ctx, video.ID, func(v *Video) error {
+			v.Title = "after"
+			v.Tags = Tags{"renamed"}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		for query, want := range map[string]int{"before": 0, "after": 1, "renamed": 1} {
+			page, err := c.SearchVideos(ctx, SearchVideosParams{UserID: userID, Query: query})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Results) != want {
+				t.Errorf("search for %q found %d videos, want %d", query, len(page.Results), want)
+			}
+		}
+
+		if err := c.RebuildSearchIndex(ctx); err != nil {
+			t.Errorf("RebuildSearchIndex: %v", err)
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MediaKind says how a media reference is removed from storage.
+type MediaKind string
+
+const (
+	// MediaObject is a single object.
+	MediaObject MediaKind = "object"
+	// MediaHLS is an HLS master playlist, removed together with everything
+	// stored next to it.
+	MediaHLS MediaKind = "hls"
+)
+
+// MediaRef is a reference to stored media as saved in the videos table.
+type MediaRef struct {
+	Ref  string
+	Kind MediaKind
+}
+
+// MediaRefs lists every piece of stored media the video references.
+func (v Video) MediaRefs() []MediaRef {
+	seen := map[string]bool{}
+	refs := []MediaRef{}
+	add := func(ref *string, kind MediaKind) {
+		if ref == nil || *ref == "" || seen[*ref] {
+			return
+		}
+		seen[*ref] = true
+		refs = append(refs, MediaRef{Ref: *ref, Kind: kind})
+	}
+
+	add(v.VideoURL, MediaObject)
+	add(v.ThumbnailURL, MediaObject)
+	for _, rendition := range v.ThumbnailRenditions {
+		add(&rendition.URL, MediaObject)
+	}
+	add(v.HLSURL, MediaHLS)
+	return refs
+}
+
+// StorageDeletion is an outbox entry for media that has to be removed from
+// storage. Entries are written in the same transaction that drops the
+// reference, so nothing is orphaned if the process stops before the
+// storage call.
+type StorageDeletion struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Attempts  int       `json:"attempts"`
+	LastError *string   `json:"last_error"`
+	RunAt     time.Time `json:"run_at"`
+	MediaRef
+}
+
+func (c Client) queueStorageDeletion(ctx context.Context, ref MediaRef) error {
+	query := `
+	INSERT INTO storage_deletions (
+		id,
+		created_at,
+		ref,
+		kind,
+		attempts,
+		run_at
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, 0, ?)
+	`
+	_, err := c.exec(ctx, query, uuid.New(), ref.Ref, ref.Kind, time.Now().UTC())
+	return err
+}
+
+// QueueStorageDeletions queues media that was stored for a change that
+// never got saved, so nothing references it.
+func (c Client) QueueStorageDeletions(ctx context.Context, refs []MediaRef) error {
+	return c.WithTx(ctx, func(tx Client) error {
+		for _, ref := range refs {
+			if err := tx.queueStorageDeletion(ctx, ref); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetDueStorageDeletions returns up to limit deletions whose next attempt
+// is due, oldest first.
+func (c Client) GetDueStorageDeletions(ctx context.Context, limit int) ([]StorageDeletion, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		ref,
+		kind,
+		attempts,
+		last_error,
+		run_at
+	FROM storage_deletions
+	WHERE run_at <= ?
+	ORDER BY run_at
+	LIMIT ?
+	`
+	rows, err := c.query(ctx, query, time.Now().UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deletions := []StorageDeletion{}
+	for rows.Next() {
+		var d StorageDeletion
+		if err := rows.Scan(&d.ID, &d.CreatedAt, &d.Ref, &d.Kind, &d.Attempts, &d.LastError, &d.RunAt); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deletions, nil
+}
+
+// CompleteStorageDeletion removes the outbox entry once the media is gone.
+func (c Client) CompleteStorageDeletion(ctx context.Context, id uuid.UUID) error {
+	_, err := c.exec(ctx, `DELETE FROM storage_deletions WHERE id = ?`, id)
+	return err
+}
+
+func (c Client) RetryStorageDeletion(ctx context.Context, id uuid.UUID, deleteErr string, runAt time.Time) error {
+	query := `
+	UPDATE storage_deletions
+	SET
+		attempts = attempts + 1,
+		last_error = ?,
+		run_at = ?
+	WHERE id = ?
+	`
+	_, err := c.exec(ctx, query, deleteErr, runAt.UTC(), id)
+	return err
+}
+
+// GetAllMediaRefs returns the media referenced by any video, including
+// trashed ones, for finding orphaned objects in storage.
+func (c Client) GetAllMediaRefs(ctx context.Context) ([]MediaRef, error) {
+	rows, err := c.query(ctx, `SELECT`+videoColumns+`FROM videos`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refs := []MediaRef{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, video.MediaRefs()...)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TrashVideo moves the video to the trash. It returns ErrNotFound if there
+// was no such video outside of the trash.
+func (c Client) TrashVideo(ctx context.Context, id uuid.UUID) error {
+	query := `
+	UPDATE videos
+	SET deleted_at = ?, version = version + 1
+	WHERE id = ? AND deleted_at IS NULL
+	`
+	res, err := c.exec(ctx, query, c.now(), id)
+	return affectedOne(res, err)
+}
+
+// RestoreVideo takes the video out of the trash. It returns ErrNotFound if
+// the video isn't in the trash.
+func (c Client) RestoreVideo(ctx context.Context, id uuid.UUID) error {
+	query := `
+	UPDATE videos
+	SET deleted_at = NULL, version = version + 1
+	WHERE id = ? AND deleted_at IS NOT NULL
+	`
+	res, err := c.exec(ctx, query, id)
+	return affectedOne(res, err)
+}
+
+// GetTrashedVideo returns the video if it's in the trash.
+func (c Client) GetTrashedVideo(ctx context.Context, id uuid.UUID) (Video, error) {
+	query := `SELECT` + videoColumns + `FROM videos WHERE id = ? AND deleted_at IS NOT NULL`
+	video, err := scanVideo(c.queryRow(ctx, query, id))
+	if err != nil {
+		return Video{}, notFound(err)
+	}
+	return video, nil
+}
+
+// GetTrashedVideos returns the user's trashed videos, most recently
+// deleted first.
+func (c Client) GetTrashedVideos(ctx context.Context, userID uuid.UUID) ([]Video, error) {
+	query := `SELECT` + videoColumns + `FROM videos WHERE user_id = ? AND deleted_at IS NOT NULL ORDER BY deleted_at DESC`
+	rows, err := c.query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return videos, nil
+}
+
+// PurgeTrashedVideos permanently deletes videos that went into the trash
+// before cutoff and returns how many there were.
+func (c Client) PurgeTrashedVideos(ctx context.Context, cutoff time.Time) (int, error) {
+	rows, err := c.query(ctx, `SELECT id FROM videos WHERE deleted_at IS NOT NULL AND deleted_at < ?`, c.timeParam(cutoff))
+	if err != nil {
+		return 0, err
+	}
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		if err := c.DeleteVideo(ctx, id); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned when the requested row doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// notFound turns sql.ErrNoRows into ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// affectedOne returns ErrNotFound if a statement changed no rows.
+func affectedOne(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// WithTx runs fn with a Client whose queries all go through one
+// transaction, committed if fn returns nil and rolled back otherwise.
+// Calling WithTx on a Client that is already in a transaction runs fn in
+// that same transaction, so operations that use WithTx can be composed.
+func (c Client) WithTx(ctx context.Context, fn func(tx Client) error) error {
+	if c.inTx() {
+		return fn(c)
+	}
+
+	sqlTx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("couldn't begin transaction: %w", err)
+	}
+	txc := c
+	txc.q = sqlTx
+
+	if err := fn(txc); err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+func (c Client) inTx() bool {
+	_, ok := c.q.(*sql.Tx)
+	return ok
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithTx(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		userID := createTestUser(t, c)
+		video := createTestVideo(t, c, CreateVideoParams{Title: "tx", UserID: userID})
+
+		rollback := errors.New("roll back")
+		err := c.WithTx(ctx, func(tx Client) error {
+			if _, err := tx.ModifyVideo(ctx, video.ID, func(v *Video) error {
+				v.Title = "changed"
+				return nil
+			}); err != nil {
+				return err
+			}
+			//a nested WithTx joins the outer transaction
+			return tx.WithTx(ctx, func(nested Client) error {
+				if nested.q != tx.q {
+					t.Errorf("nested WithTx started a second transaction")
+				}
+				return nested.TrashVideo(ctx, video.ID)
+			})
+		})
+		if err != nil {
+			t.Fatalf("WithTx: %v", err)
+		}
+		if _, err := c.GetTrashedVideo(ctx, video.ID); err != nil {
+			t.Errorf("committed changes are missing: %v", err)
+		}
+
+		err = c.WithTx(ctx, func(tx Client) error {
+			if err := tx.RestoreVideo(ctx, video.ID); err != nil {
+				return err
+			}
+			return rollback
+		})
+		if !errors.Is(err, rollback) {
+			t.Fatalf("WithTx returned %v, want fn's error", err)
+		}
+		trashed, err := c.GetTrashedVideo(ctx, video.ID)
+		if err != nil {
+			t.Fatalf("rolled back restore took the video out of the trash: %v", err)
+		}
+		if trashed.Title != "changed" {
+			t.Errorf("title = %q", trashed.Title)
+		}
+	})
+}
+
+func TestUsersAndRefreshTokens(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		user, err := c.CreateUser(ctx, CreateUserParams{Email: "a@example.com", Password: "hash"})
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if _, err := c.CreateUser(ctx, CreateUserParams{Email: "a@example.com", Password: "hash"}); err == nil {
+			t.Errorf("created two users with the same email")
+		}
+		byEmail, err := c.GetUserByEmail(ctx, "a@example.com")
+		if err != nil || byEmail.ID != user.ID {
+			t.Fatalf("GetUserByEmail = %v, %v", byEmail.ID, err)
+		}
+
+		expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		token, err := c.CreateRefreshToken(ctx, CreateRefreshTokenParams{Token: "token", UserID: user.ID, ExpiresAt: expires})
+		if err != nil {
+			t.Fatalf("CreateRefreshToken: %v", err)
+		}
+		if !token.ExpiresAt.Equal(expires) || token.RevokedAt != nil {
+			t.Errorf("token expires %v, revoked %v", token.ExpiresAt, token.RevokedAt)
+		}
+		owner, err := c.GetUserByRefreshToken(ctx, "token")
+		if err != nil || owner.ID != user.ID {
+			t.Fatalf("GetUserByRefreshToken = %v, %v", owner, err)
+		}
+		if err := c.RevokeRefreshToken(ctx, "token"); err != nil {
+			t.Fatal(err)
+		}
+		if token, err := c.GetRefreshToken(ctx, "token"); err != nil || token.RevokedAt == nil {
+			t.Errorf("revoked token = %+v, %v", token, err)
+		}
+
+		if err := c.DeleteUser(ctx, user.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.GetUser(ctx, user.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetUser of a deleted user: %v, want ErrNotFound", err)
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type UploadSession struct {
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Offset      int64      `json:"offset"`
+	StagingPath string     `json:"-"`
+	CompletedAt *time.Time `json:"completed_at"`
+	CreateUploadSessionParams
+}
+
+type CreateUploadSessionParams struct {
+	VideoID uuid.UUID `json:"video_id"`
+	UserID  uuid.UUID `json:"user_id"`
+	Size    int64     `json:"size"`
+}
+
+// CreateUploadSession inserts a session that hasn't received anything yet
+// and returns it as stored, in one statement.
+func (c Client) CreateUploadSession(ctx context.Context, params CreateUploadSessionParams, stagingPath string) (UploadSession, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO upload_sessions (
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		user_id,
+		size,
+		upload_offset,
+		staging_path
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, 0, ?)
+	RETURNING` + uploadSessionColumns
+	session, err := scanUploadSession(c.queryRow(ctx, query, id, params.VideoID, params.UserID, params.Size, stagingPath))
+	if err != nil {
+		return UploadSession{}, err
+	}
+	return session, nil
+}
+
+const uploadSessionColumns = `
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		user_id,
+		size,
+		upload_offset,
+		staging_path,
+		completed_at
+`
+
+func scanUploadSession(row interface{ Scan(...any) error }) (UploadSession, error) {
+	var session UploadSession
+	err := row.Scan(
+		&session.ID,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+		&session.VideoID,
+		&session.UserID,
+		&session.Size,
+		&session.Offset,
+		&session.StagingPath,
+		&session.CompletedAt)
+	return session, err
+}
+
+func (c Client) GetUploadSession(ctx context.Context, id uuid.UUID) (UploadSession, error) {
+	query := `SELECT` + uploadSessionColumns + `FROM upload_sessions WHERE id = ?`
+	session, err := scanUploadSession(c.queryRow(ctx, query, id))
+	if err != nil {
+		return UploadSession{}, notFound(err)
+	}
+
+	return session, nil
+}
+
+// GetStaleUploadSessions returns the sessions, complete or not, that nothing
+// was written to since cutoff.
+func (c Client) GetStaleUploadSessions(ctx context.Context, cutoff time.Time) ([]UploadSession, error) {
+	query := `SELECT` + uploadSessionColumns + `FROM upload_sessions WHERE updated_at < ? ORDER BY updated_at`
+	rows, err := c.query(ctx, query, c.timeParam(cutoff))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []UploadSession{}
+	for rows.Next() {
+		session, err := scanUploadSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (c Client) UpdateUploadSessionOffset(ctx context.Context, id uuid.UUID, offset int64) error {
+	query := `
+	UPDATE upload_sessions
+	SET
+		upload_offset = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.exec(ctx, query, offset, id)
+	return err
+}
+
+func (c Client) CompleteUploadSession(ctx context.Context, id uuid.UUID) error {
+	query := `
+	UPDATE upload_sessions
+	SET
+		completed_at = CURRENT_TIMESTAMP,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.exec(ctx, query, id)
+	return err
+}
+
+func (c Client) DeleteUploadSession(ctx context.Context, id uuid.UUID) error {
+	query := `
+	DELETE FROM upload_sessions
+	WHERE id = ?
+	`
+	_, err := c.exec(ctx, query, id)
+	return err
+}
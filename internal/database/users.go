@@ -1,8 +1,7 @@
 package database
 
 import (
-	"database/sql"
-	"errors"
+	"context"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,7 +19,7 @@ type CreateUserParams struct {
 	Password string `json:"password"`
 }
 
-func (c Client) GetUsers() ([]User, error) {
+func (c Client) GetUsers(ctx context.Context) ([]User, error) {
 	query := `
 		SELECT
 			id,
@@ -28,7 +27,7 @@ func (c Client) GetUsers() ([]User, error) {
 		FROM users
 	`
 
-	rows, err := c.db.Query(query)
+	rows, err := c.query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -51,7 +50,7 @@ func (c Client) GetUsers() ([]User, error) {
 	return users, nil
 }
 
-func (c Client) GetUserByEmail(email string) (User, error) {
+func (c Client) GetUserByEmail(ctx context.Context, email string) (User, error) {
 	query := `
 		SELECT id, created_at, updated_at, email, password
 		FROM users
@@ -59,12 +58,9 @@ func (c Client) GetUserByEmail(email string) (User, error) {
 	`
 	var user User
 	var id string
-	err := c.db.QueryRow(query, email).Scan(&id, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
+	err := c.queryRow(ctx, query, email).Scan(&id, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return User{}, nil
-		}
-		return User{}, err
+		return User{}, notFound(err)
 	}
 	user.ID, err = uuid.Parse(id)
 	if err != nil {
@@ -73,7 +69,7 @@ func (c Client) GetUserByEmail(email string) (User, error) {
 	return user, nil
 }
 
-func (c Client) GetUserByRefreshToken(token string) (*User, error) {
+func (c Client) GetUserByRefreshToken(ctx context.Context, token string) (*User, error) {
 	query := `
 		SELECT u.id, u.email, u.created_at, u.updated_at, u.password
 		FROM users u
@@ -83,12 +79,9 @@ func (c Client) GetUserByRefreshToken(token string) (*User, error) {
 
 	var user User
 	var id string
-	err := c.db.QueryRow(query, token).Scan(&id, &user.Email, &user.CreatedAt, &user.UpdatedAt, &user.Password)
+	err := c.queryRow(ctx, query, token).Scan(&id, &user.Email, &user.CreatedAt, &user.UpdatedAt, &user.Password)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
-		}
-		return nil, err
+		return nil, notFound(err)
 	}
 	user.ID, err = uuid.Parse(id)
 	if err != nil {
@@ -98,7 +91,7 @@ func (c Client) GetUserByRefreshToken(token string) (*User, error) {
 	return &user, nil
 }
 
-func (c Client) CreateUser(params CreateUserParams) (*User, error) {
+func (c Client) CreateUser(ctx context.Context, params CreateUserParams) (*User, error) {
 	id := uuid.New()
 
 	query := `
@@ -107,15 +100,22 @@ func (c Client) CreateUser(params CreateUserParams) (*User, error) {
 		VALUES
 		    (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
 	`
-	_, err := c.db.Exec(query, id.String(), params.Email, params.Password)
+	var user *User
+	err := c.WithTx(ctx, func(tx Client) error {
+		_, err := tx.exec(ctx, query, id.String(), params.Email, params.Password)
+		if err != nil {
+			return err
+		}
+		user, err = tx.GetUser(ctx, id)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	return c.GetUser(id)
+	return user, nil
 }
 
-func (c Client) GetUser(id uuid.UUID) (*User, error) {
+func (c Client) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
 	query := `
 		SELECT id, created_at, updated_at, email, password
 		FROM users
@@ -123,12 +123,9 @@ func (c Client) GetUser(id uuid.UUID) (*User, error) {
 	`
 	var user User
 	var idStr string
-	err := c.db.QueryRow(query, id.String()).Scan(&idStr, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
+	err := c.queryRow(ctx, query, id.String()).Scan(&idStr, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
-		}
-		return nil, err
+		return nil, notFound(err)
 	}
 	user.ID, err = uuid.Parse(idStr)
 	if err != nil {
@@ -137,11 +134,11 @@ func (c Client) GetUser(id uuid.UUID) (*User, error) {
 	return &user, nil
 }
 
-func (c Client) DeleteUser(id uuid.UUID) error {
+func (c Client) DeleteUser(ctx context.Context, id uuid.UUID) error {
 	query := `
 		DELETE FROM users
 		WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id.String())
+	_, err := c.exec(ctx, query, id.String())
 	return err
 }
@@ -0,0 +1,218 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoSort is the order GetVideos returns videos in.
+type VideoSort string
+
+const (
+	VideoSortCreated  VideoSort = "created"
+	VideoSortUpdated  VideoSort = "updated"
+	VideoSortTitle    VideoSort = "title"
+	VideoSortDuration VideoSort = "duration"
+)
+
+const (
+	DefaultVideoPageSize = 50
+	MaxVideoPageSize     = 100
+)
+
+// ErrInvalidCursor is returned for a cursor that wasn't produced by a
+// listing with the same sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// the sort key of each order, videos without a duration sort as the shortest
+var videoSortColumns = map[VideoSort]string{
+	VideoSortCreated:  "created_at",
+	VideoSortUpdated:  "updated_at",
+	VideoSortTitle:    "title",
+	VideoSortDuration: "COALESCE(duration, -1)",
+}
+
+func (s VideoSort) Valid() bool {
+	_, ok := videoSortColumns[s]
+	return ok
+}
+
+// DefaultDescending is the direction used when none is asked for: newest
+// and longest first, titles alphabetically.
+func (s VideoSort) DefaultDescending() bool {
+	return s != VideoSortTitle
+}
+
+type GetVideosParams struct {
+	UserID uuid.UUID
+	// Status only returns videos in that status when set.
+	Status VideoStatus
+	// Query only returns videos whose title, description or tags contain
+	// words starting with each of its words when set.
+	Query      string
+	Sort       VideoSort
+	Descending bool
+	// Cursor continues after the page that returned it.
+	Cursor string
+	Limit  int
+}
+
+type VideoPage struct {
+	Videos []Video
+	// NextCursor is empty on the last page.
+	NextCursor string
+}
+
+// videoCursor is the position after the last video of a page: its sort key
+// and its id, which breaks ties. The order is kept so a cursor can't be
+// used with a different one.
+type videoCursor struct {
+	Sort       VideoSort       `json:"s"`
+	Descending bool            `json:"d"`
+	Key        json.RawMessage `json:"k"`
+	ID         uuid.UUID       `json:"id"`
+}
+
+// GetVideos returns a page of the user's videos that aren't in the trash.
+// Pages are keyset paginated, so videos added or removed between requests
+// don't shift the following pages.
+func (c Client) GetVideos(ctx context.Context, params GetVideosParams) (VideoPage, error) {
+	sort := params.Sort
+	if sort == "" {
+		sort = VideoSortCreated
+	}
+	column, ok := videoSortColumns[sort]
+	if !ok {
+		return VideoPage{}, fmt.Errorf("unknown video sort %q", sort)
+	}
+	limit := params.Limit
+	if limit <= 0 {
+		limit = DefaultVideoPageSize
+	}
+	limit = min(limit, MaxVideoPageSize)
+
+	query := `SELECT` + videoColumns + `FROM videos WHERE user_id = ? AND deleted_at IS NULL`
+	args := []any{params.UserID}
+	if params.Status != "" {
+		query += ` AND status = ?`
+		args = append(args, params.Status)
+	}
+	if terms := strings.Fields(params.Query); len(terms) > 0 {
+		query += ` AND ` + c.videoMatchClause()
+		args = append(args, c.searchQuery(terms))
+	}
+
+	direction, compare := "ASC", ">"
+	if params.Descending {
+		direction, compare = "DESC", "<"
+	}
+	if params.Cursor != "" {
+		key, id, err := c.decodeVideoCursor(params.Cursor, sort, params.Descending)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		query += ` AND (` + column + `, id) ` + compare + ` (?, ?)`
+		args = append(args, key, id)
+	}
+	//one extra row tells whether there's another page
+	query += ` ORDER BY ` + column + ` ` + direction + `, id ` + direction + ` LIMIT ?`
+	args = append(args, limit+1)
+
+	rows, err := c.query(ctx, query, args...)
+	if err != nil {
+		return VideoPage{}, err
+	}
+	defer rows.Close()
+
+	page := VideoPage{Videos: []Video{}}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		page.Videos = append(page.Videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return VideoPage{}, err
+	}
+
+	if len(page.Videos) > limit {
+		page.Videos = page.Videos[:limit]
+		page.NextCursor, err = encodeVideoCursor(page.Videos[limit-1], sort, params.Descending)
+		if err != nil {
+			return VideoPage{}, err
+		}
+	}
+	return page, nil
+}
+
+func encodeVideoCursor(video Video, sort VideoSort, descending bool) (string, error) {
+	var key any
+	switch sort {
+	case VideoSortUpdated:
+		key = video.UpdatedAt
+	case VideoSortTitle:
+		key = video.Title
+	case VideoSortDuration:
+		key = -1.0
+		if video.Duration != nil {
+			key = *video.Duration
+		}
+	default:
+		key = video.CreatedAt
+	}
+	keyJSON, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(videoCursor{Sort: sort, Descending: descending, Key: keyJSON, ID: video.ID})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeVideoCursor returns the sort key and id to continue after, with the
+// key ready to be compared to its column.
+func (c Client) decodeVideoCursor(s string, sort VideoSort, descending bool) (any, uuid.UUID, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, uuid.Nil, ErrInvalidCursor
+	}
+	var cursor videoCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, uuid.Nil, ErrInvalidCursor
+	}
+	if cursor.Sort != sort || cursor.Descending != descending {
+		return nil, uuid.Nil, fmt.Errorf("%w: it belongs to a different sort order", ErrInvalidCursor)
+	}
+
+	switch sort {
+	case VideoSortTitle:
+		var title string
+		err = json.Unmarshal(cursor.Key, &title)
+		return title, cursor.ID, cursorErr(err)
+	case VideoSortDuration:
+		var duration float64
+		err = json.Unmarshal(cursor.Key, &duration)
+		return duration, cursor.ID, cursorErr(err)
+	default:
+		var t time.Time
+		err = json.Unmarshal(cursor.Key, &t)
+		return c.timeParam(t), cursor.ID, cursorErr(err)
+	}
+}
+
+func cursorErr(err error) error {
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestGetVideosPagination(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		userID := createTestUser(t, c)
+		other := createTestUser(t, c)
+		//created in the same second, so the ids have to break the ties
+		for i := 0; i < 7; i++ {
+			createTestVideo(t, c, CreateVideoParams{Title: fmt.Sprintf("video %d", i%3), UserID: userID})
+		}
+		createTestVideo(t, c, CreateVideoParams{Title: "someone else's", UserID: other})
+
+		for sort := range videoSortColumns {
+			for _, descending := range []bool{false, true} {
+				seen := map[uuid.UUID]bool{}
+				params := GetVideosParams{UserID: userID, Sort: sort, Descending: descending, Limit: 3}
+				for pages := 0; ; pages++ {
+					if pages > 3 {
+						t.Fatalf("%s descending=%v: too many pages", sort, descending)
+					}
+					page, err := c.GetVideos(ctx, params)
+					if err != nil {
+						t.Fatalf("%s descending=%v: %v", sort, descending, err)
+					}
+					for _, video := range page.Videos {
+						if seen[video.ID] {
+							t.Errorf("%s descending=%v: %s listed twice", sort, descending, video.ID)
+						}
+						seen[video.ID] = true
+					}
+					if page.NextCursor == "" {
+						break
+					}
+					params.Cursor = page.NextCursor
+				}
+				if len(seen) != 7 {
+					t.Errorf("%s descending=%v: listed %d of 7 videos", sort, descending, len(seen))
+				}
+			}
+		}
+
+		page, err := c.GetVideos(ctx, GetVideosParams{UserID: userID, Limit: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.GetVideos(ctx, GetVideosParams{UserID: userID, Sort: VideoSortTitle, Cursor: page.NextCursor})
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("cursor used with another sort: %v, want ErrInvalidCursor", err)
+		}
+	})
+}
+
+func TestGetVideosFilters(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		userID := createTestUser(t, c)
+		pasta := createTestVideo(t, c, CreateVideoParams{Title: "Fresh pasta", UserID: userID})
+		createTestVideo(t, c, CreateVideoParams{Title: "Bread", Description: "100% rye", UserID: userID, Tags: Tags{"baking"}})
+		if _, err := c.TransitionVideoStatus(ctx, pasta.ID, VideoStatusUploading, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			params GetVideosParams
+			want   int
+		}{
+			{GetVideosParams{Query: "past"}, 1},
+			{GetVideosParams{Query: "bak"}, 1},
+			{GetVideosParams{Query: "100%"}, 1},
+			{GetVideosParams{Query: "fresh bread"}, 0},
+			{GetVideosParams{Status: VideoStatusUploading}, 1},
+			{GetVideosParams{Status: VideoStatusDraft}, 1},
+		}
+		for _, tt := range tests {
+			tt.params.UserID = userID
+			page, err := c.GetVideos(ctx, tt.params)
+			if err != nil {
+				t.Fatalf("%+v: %v", tt.params, err)
+			}
+			if len(page.Videos) != tt.want {
+				t.Errorf("query %q status %q: got %d videos, want %d", tt.params.Query, tt.params.Status, len(page.Videos), tt.want)
+			}
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoStatus is where a video is in its lifecycle:
+//
+//	draft → uploading → processing → ready
+//	                               ↘ failed
+//
+// Ready and failed videos can be uploaded again and an abandoned upload goes
+// back to draft, or to ready if the video already had a file. An upload in
+// progress has to be abandoned before another one can start, so two uploads
+// never run for the same video.
+type VideoStatus string
+
+const (
+	VideoStatusDraft      VideoStatus = "draft"
+	VideoStatusUploading  VideoStatus = "uploading"
+	VideoStatusProcessing VideoStatus = "processing"
+	VideoStatusReady      VideoStatus = "ready"
+	VideoStatusFailed     VideoStatus = "failed"
+)
+
+var videoTransitions = map[VideoStatus][]VideoStatus{
+	VideoStatusDraft:      {VideoStatusUploading},
+	VideoStatusUploading:  {VideoStatusProcessing, VideoStatusDraft, VideoStatusReady},
+	VideoStatusProcessing: {VideoStatusReady, VideoStatusFailed},
+	VideoStatusReady:      {VideoStatusUploading},
+	VideoStatusFailed:     {VideoStatusUploading},
+}
+
+// the column recording when a video last entered each status
+var videoStatusTimestamps = map[VideoStatus]string{
+	VideoStatusUploading:  "upload_started_at",
+	VideoStatusProcessing: "processing_started_at",
+	VideoStatusReady:      "ready_at",
+	VideoStatusFailed:     "failed_at",
+}
+
+// ErrInvalidVideoTransition is returned when a video's current status
+// doesn't allow moving to the requested one.
+var ErrInvalidVideoTransition = errors.New("invalid video status transition")
+
+type VideoStatusInfo struct {
+	Status              VideoStatus `json:"status"`
+	FailureReason       *string     `json:"failure_reason"`
+	UploadStartedAt     *time.Time  `json:"upload_started_at"`
+	ProcessingStartedAt *time.Time  `json:"processing_started_at"`
+	ReadyAt             *time.Time  `json:"ready_at"`
+	FailedAt            *time.Time  `json:"failed_at"`
+}
+
+func (s VideoStatus) Valid() bool {
+	_, ok := videoTransitions[s]
+	return ok
+}
+
+func (s VideoStatus) CanTransitionTo(to VideoStatus) bool {
+	for _, next := range videoTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionVideoStatus moves the video to status if its current status
+// allows it, checking and updating in one statement so concurrent requests
+// can't both make the same transition. failureReason is only kept for
+// failed videos.
+func (c Client) TransitionVideoStatus(ctx context.Context, id uuid.UUID, status VideoStatus, failureReason string) (Video, error) {
+	var from []any
+	for s := range videoTransitions {
+		if s.CanTransitionTo(status) {
+			from = append(from, s)
+		}
+	}
+	if len(from) == 0 {
+		return Video{}, fmt.Errorf("%w: nothing moves to %q", ErrInvalidVideoTransition, status)
+	}
+
+	var reason *string
+	if status == VideoStatusFailed {
+		reason = &failureReason
+	}
+	set := "status = ?, failure_reason = ?, updated_at = ?, version = version + 1"
+	if column, ok := videoStatusTimestamps[status]; ok {
+		set += ", " + column + " = CURRENT_TIMESTAMP"
+	}
+	query := `UPDATE videos SET ` + set + ` WHERE id = ? AND deleted_at IS NULL AND status IN (?` + strings.Repeat(", ?", len(from)-1) + `)`
+	args := append([]any{status, reason, c.now(), id}, from...)
+
+	res, err := c.exec(ctx, query, args...)
+	if err != nil {
+		return Video{}, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return Video{}, err
+	}
+
+	video, err := c.GetVideo(ctx, id)
+	if err != nil {
+		return Video{}, err
+	}
+	if n == 0 {
+		return video, fmt.Errorf("%w: video is %s, can't move to %s", ErrInvalidVideoTransition, video.Status, status)
+	}
+	return video, nil
+}
+
+// FailInterruptedVideos marks videos that were processing when the server
+// stopped as failed, so they can be uploaded again.
+func (c Client) FailInterruptedVideos(ctx context.Context) error {
+	query := `
+	UPDATE videos
+	SET
+		status = ?,
+		failure_reason = ?,
+		failed_at = CURRENT_TIMESTAMP,
+		updated_at = ?,
+		version = version + 1
+	WHERE status = ?
+	`
+	_, err := c.exec(ctx, query, VideoStatusFailed, "processing was interrupted", c.now(), VideoStatusProcessing)
+	return err
+}
+
+// GetStaleUploadingVideos returns videos that have been uploading since
+// before cutoff without an upload session, i.e. direct uploads that were
+// presigned and never completed.
+func (c Client) GetStaleUploadingVideos(ctx context.Context, cutoff time.Time) ([]Video, error) {
+	query := `SELECT` + videoColumns + `FROM videos
+	WHERE status = ? AND updated_at < ? AND deleted_at IS NULL
+	AND NOT EXISTS (SELECT 1 FROM upload_sessions WHERE upload_sessions.video_id = videos.id)
+	ORDER BY updated_at`
+	rows, err := c.query(ctx, query, VideoStatusUploading, c.timeParam(cutoff))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return videos, nil
+}
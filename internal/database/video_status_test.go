@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// videoStatusPaths are the transitions that take a new video to each status.
+var videoStatusPaths = map[VideoStatus][]VideoStatus{
+	VideoStatusDraft:      {},
+	VideoStatusUploading:  {VideoStatusUploading},
+	VideoStatusProcessing: {VideoStatusUploading, VideoStatusProcessing},
+	VideoStatusReady:      {VideoStatusUploading, VideoStatusProcessing, VideoStatusReady},
+	VideoStatusFailed:     {VideoStatusUploading, VideoStatusProcessing, VideoStatusFailed},
+}
+
+func TestTransitionVideoStatus(t *testing.T) {
+	statuses := []VideoStatus{VideoStatusDraft, VideoStatusUploading, VideoStatusProcessing, VideoStatusReady, VideoStatusFailed}
+	allowed := map[[2]VideoStatus]bool{
+		{VideoStatusDraft, VideoStatusUploading}:      true,
+		{VideoStatusUploading, VideoStatusProcessing}: true,
+		{VideoStatusUploading, VideoStatusDraft}:      true,
+		{VideoStatusUploading, VideoStatusReady}:      true,
+		{VideoStatusProcessing, VideoStatusReady}:     true,
+		{VideoStatusProcessing, VideoStatusFailed}:    true,
+		{VideoStatusReady, VideoStatusUploading}:      true,
+		{VideoStatusFailed, VideoStatusUploading}:     true,
+	}
+
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		userID := createTestUser(t, c)
+		for _, from := range statuses {
+			for _, to := range statuses {
+				t.Run(string(from)+"→"+string(to), func(t *testing.T) {
+					video := createTestVideo(t, c, CreateVideoParams{Title: "status", UserID: userID})
+					for _, status := range videoStatusPaths[from] {
+						var err error
+						video, err = c.TransitionVideoStatus(ctx, video.ID, status, "reason")
+						if err != nil {
+							t.Fatalf("moving to %s: %v", status, err)
+						}
+					}
+
+					got, err := c.TransitionVideoStatus(ctx, video.ID, to, "reason")
+					if allowed[[2]VideoStatus{from, to}] {
+						if err != nil {
+							t.Fatalf("TransitionVideoStatus = %v", err)
+						}
+						if got.Status != to || got.Version != video.Version+1 {
+							t.Errorf("got status %s version %d, want %s version %d", got.Status, got.Version, to, video.Version+1)
+						}
+						return
+					}
+					if !errors.Is(err, ErrInvalidVideoTransition) {
+						t.Fatalf("TransitionVideoStatus = %v, want ErrInvalidVideoTransition", err)
+					}
+					if got.Status != from || got.Version != video.Version {
+						t.Errorf("rejected transition changed the video to %s version %d", got.Status, got.Version)
+					}
+				})
+			}
+		}
+	})
+}
+
+func TestFailInterruptedVideos(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		userID := createTestUser(t, c)
+		videos := map[VideoStatus]Video{}
+		for _, status := range []VideoStatus{VideoStatusUploading, VideoStatusProcessing} {
+			video := createTestVideo(t, c, CreateVideoParams{Title: string(status), UserID: userID})
+			for _, step := range videoStatusPaths[status] {
+				var err error
+				video, err = c.TransitionVideoStatus(ctx, video.ID, step, "")
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			videos[status] = video
+		}
+
+		if err := c.FailInterruptedVideos(ctx); err != nil {
+			t.Fatalf("FailInterruptedVideos: %v", err)
+		}
+
+		processing := videos[VideoStatusProcessing]
+		got, err := c.GetVideo(ctx, processing.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != VideoStatusFailed || got.FailureReason == nil {
+			t.Errorf("interrupted video is %s, reason %v", got.Status, got.FailureReason)
+		}
+		//clients holding the old ETag have to see the change
+		if got.Version != processing.Version+1 || !got.UpdatedAt.After(processing.UpdatedAt) {
+			t.Errorf("version %d updated %v, was version %d updated %v", got.Version, got.UpdatedAt, processing.Version, processing.UpdatedAt)
+		}
+
+		uploading := videos[VideoStatusUploading]
+		got, err = c.GetVideo(ctx, uploading.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != VideoStatusUploading || got.Version != uploading.Version {
+			t.Errorf("uploading video was changed to %s version %d", got.Status, got.Version)
+		}
+	})
+}
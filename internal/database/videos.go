@@ -1,108 +1,154 @@
 package database
 
 import (
-	"database/sql"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Version goes up by one with every change to the video.
+	Version      int64    `json:"version"`
+	ThumbnailURL *string  `json:"thumbnail_url"`
+	VideoURL     *string  `json:"video_url"`
+	Width        *int     `json:"width"`
+	Height       *int     `json:"height"`
+	Duration     *float64 `json:"duration"`
+	Codec        *string  `json:"codec"`
+	HLSURL       *string  `json:"hls_manifest_url"`
+	// DeletedAt is set while the video is in the trash.
+	DeletedAt *time.Time `json:"deleted_at"`
+	VideoStatusInfo
 	CreateVideoParams
+	ThumbnailRenditions ThumbnailRenditions `json:"thumbnail_renditions"`
 }
 
-type CreateVideoParams struct {
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	UserID      uuid.UUID `json:"user_id"`
+type ThumbnailRendition struct {
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+	URL         string `json:"url"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
-	FROM videos
-	WHERE user_id = ?
-	ORDER BY created_at DESC
-	`
-
-	rows, err := c.db.Query(query, userID)
+// ThumbnailRenditions is stored as a JSON array in a single column.
+type ThumbnailRenditions []ThumbnailRendition
+
+func (r *ThumbnailRenditions) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*r = ThumbnailRenditions{}
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("unsupported type %T for thumbnail renditions", src)
+	}
+	renditions := ThumbnailRenditions{}
+	if err := json.Unmarshal(data, &renditions); err != nil {
+		return err
+	}
+	*r = renditions
+	return nil
+}
+
+func (r ThumbnailRenditions) Value() (driver.Value, error) {
+	if len(r) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(r)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	videos := []Video{}
-	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
-			return nil, err
-		}
-		videos = append(videos, video)
-	}
+	return string(data), nil
+}
 
-	return videos, nil
+// Tags is stored as a JSON array in a single column.
+type Tags []string
+
+func (t *Tags) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*t = Tags{}
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("unsupported type %T for tags", src)
+	}
+	tags := Tags{}
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return err
+	}
+	*t = tags
+	return nil
 }
 
-func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
-	id := uuid.New()
-	query := `
-	INSERT INTO videos (
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
-	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+func (t Tags) Value() (driver.Value, error) {
+	if len(t) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(t)
 	if err != nil {
-		return Video{}, err
+		return nil, err
 	}
+	return string(data), nil
+}
 
-	return c.GetVideo(id)
+type CreateVideoParams struct {
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	UserID      uuid.UUID `json:"user_id"`
+	Tags        Tags      `json:"tags"`
+	// IsPublic videos can be found by every user's search.
+	IsPublic bool `json:"is_public"`
 }
 
-func (c Client) GetVideo(id uuid.UUID) (Video, error) {
-	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
-	FROM videos
-	WHERE id = ?
-	`
+// videoColumns are in scanVideo's order, qualified so they can be selected
+// from a join with the search index.
+const videoColumns = `
+		videos.id,
+		videos.created_at,
+		videos.updated_at,
+		videos.title,
+		videos.description,
+		videos.thumbnail_url,
+		videos.video_url,
+		videos.user_id,
+		videos.width,
+		videos.height,
+		videos.duration,
+		videos.codec,
+		videos.thumbnail_renditions,
+		videos.hls_manifest_url,
+		videos.status,
+		videos.failure_reason,
+		videos.upload_started_at,
+		videos.processing_started_at,
+		videos.ready_at,
+		videos.failed_at,
+		videos.deleted_at,
+		videos.tags,
+		videos.is_public,
+		videos.version
+`
 
+func scanVideo(row interface{ Scan(...any) error }) (Video, error) {
 	var video Video
-	err := c.db.QueryRow(query, id).Scan(
+	err := row.Scan(
 		&video.ID,
 		&video.CreatedAt,
 		&video.UpdatedAt,
@@ -110,46 +156,199 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 		&video.Description,
 		&video.ThumbnailURL,
 		&video.VideoURL,
-		&video.UserID)
+		&video.UserID,
+		&video.Width,
+		&video.Height,
+		&video.Duration,
+		&video.Codec,
+		&video.ThumbnailRenditions,
+		&video.HLSURL,
+		&video.Status,
+		&video.FailureReason,
+		&video.UploadStartedAt,
+		&video.ProcessingStartedAt,
+		&video.ReadyAt,
+		&video.FailedAt,
+		&video.DeletedAt,
+		&video.Tags,
+		&video.IsPublic,
+		&video.Version,
+	)
+	return video, err
+}
+
+// CreateVideo inserts a draft video and returns it as stored, in one
+// statement.
+func (c Client) CreateVideo(ctx context.Context, params CreateVideoParams) (Video, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO videos (
+		id,
+		created_at,
+		updated_at,
+		title,
+		description,
+		user_id,
+		status,
+		tags,
+		is_public
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?)
+	RETURNING` + videoColumns
+	video, err := scanVideo(c.queryRow(ctx, query, id, params.Title, params.Description, params.UserID, VideoStatusDraft, params.Tags, params.IsPublic))
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return Video{}, nil
-		}
 		return Video{}, err
 	}
+	return video, nil
+}
+
+// GetVideo returns the video unless it's in the trash.
+func (c Client) GetVideo(ctx context.Context, id uuid.UUID) (Video, error) {
+	query := `SELECT` + videoColumns + `FROM videos WHERE id = ? AND deleted_at IS NULL`
+	video, err := scanVideo(c.queryRow(ctx, query, id))
+	if err != nil {
+		return Video{}, notFound(err)
+	}
 
 	return video, nil
 }
 
-func (c Client) UpdateVideo(video Video) error {
-	query := `
-	UPDATE videos
-	SET
-		title = ?,
-		description = ?,
-		thumbnail_url = ?,
-		video_url = ?,
-		user_id = ?
-	WHERE id = ?
-	`
-
-	_, err := c.db.Exec(
-		query,
-		video.Title,
-		video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		video.UserID,
-		video.ID,
-	)
-	return err
+// ErrVersionConflict is returned by UpdateVideo when the video was changed
+// after the version being saved was read.
+var ErrVersionConflict = errors.New("video was changed concurrently")
+
+// maxModifyAttempts bounds how often ModifyVideo retries after a conflict.
+const maxModifyAttempts = 5
+
+// UpdateVideo saves the video's metadata if the stored video is still at
+// video.Version, bumping the version and updated_at, and returns the saved
+// video. The status is only changed through TransitionVideoStatus. Media
+// the video no longer references is queued for deletion in the same
+// transaction. It returns ErrNotFound if the video doesn't exist or is in
+// the trash, and ErrVersionConflict if it was changed since it was read.
+func (c Client) UpdateVideo(ctx context.Context, video Video) (Video, error) {
+	var saved Video
+	err := c.WithTx(ctx, func(tx Client) error {
+		old, err := tx.GetVideo(ctx, video.ID)
+		if err != nil {
+			return err
+		}
+		if old.Version != video.Version {
+			return ErrVersionConflict
+		}
+
+		query := `
+		UPDATE videos
+		SET
+			updated_at = ?,
+			version = version + 1,
+			title = ?,
+			description = ?,
+			thumbnail_url = ?,
+			video_url = ?,
+			user_id = ?,
+			width = ?,
+			height = ?,
+			duration = ?,
+			codec = ?,
+			thumbnail_renditions = ?,
+			hls_manifest_url = ?,
+			tags = ?,
+			is_public = ?
+		WHERE id = ? AND version = ? AND deleted_at IS NULL
+		`
+
+		res, err := tx.exec(ctx,
+			query,
+			tx.now(),
+			video.Title,
+			video.Description,
+			&video.ThumbnailURL,
+			&video.VideoURL,
+			video.UserID,
+			video.Width,
+			video.Height,
+			video.Duration,
+			video.Codec,
+			video.ThumbnailRenditions,
+			video.HLSURL,
+			video.Tags,
+			video.IsPublic,
+			video.ID,
+			video.Version,
+		)
+		//the row was read above, so no match means another update got in first
+		if err := affectedOne(res, err); errors.Is(err, ErrNotFound) {
+			return ErrVersionConflict
+		} else if err != nil {
+			return err
+		}
+
+		current := map[MediaRef]bool{}
+		for _, ref := range video.MediaRefs() {
+			current[ref] = true
+		}
+		for _, ref := range old.MediaRefs() {
+			if current[ref] {
+				continue
+			}
+			if err := tx.queueStorageDeletion(ctx, ref); err != nil {
+				return err
+			}
+		}
+
+		saved, err = tx.GetVideo(ctx, video.ID)
+		return err
+	})
+	if err != nil {
+		return Video{}, err
+	}
+	return saved, nil
 }
 
-func (c Client) DeleteVideo(id uuid.UUID) error {
-	query := `
-	DELETE FROM videos
-	WHERE id = ?
-	`
-	_, err := c.db.Exec(query, id)
-	return err
+// ModifyVideo applies change to the latest version of the video and saves
+// it, reloading and applying change again if another update got in first.
+// An error from change is returned as is without saving.
+func (c Client) ModifyVideo(ctx context.Context, id uuid.UUID, change func(video *Video) error) (Video, error) {
+	for attempt := 1; ; attempt++ {
+		video, err := c.GetVideo(ctx, id)
+		if err != nil {
+			return Video{}, err
+		}
+		if err := change(&video); err != nil {
+			return Video{}, err
+		}
+		saved, err := c.UpdateVideo(ctx, video)
+		if errors.Is(err, ErrVersionConflict) && attempt < maxModifyAttempts {
+			continue
+		}
+		return saved, err
+	}
+}
+
+// DeleteVideo permanently removes the video, trashed or not, and queues all
+// of its media for deletion. It returns ErrNotFound if there's no such
+// video.
+func (c Client) DeleteVideo(ctx context.Context, id uuid.UUID) error {
+	return c.WithTx(ctx, func(tx Client) error {
+		video, err := scanVideo(tx.queryRow(ctx, `SELECT`+videoColumns+`FROM videos WHERE id = ?`, id))
+		if err != nil {
+			return notFound(err)
+		}
+
+		query := `
+		DELETE FROM videos
+		WHERE id = ?
+		`
+		_, err = tx.exec(ctx, query, id)
+		if err != nil {
+			return err
+		}
+
+		for _, ref := range video.MediaRefs() {
+			if err := tx.queueStorageDeletion(ctx, ref); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
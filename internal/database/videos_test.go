@@ -0,0 +1,257 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateAndGetVideo(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		userID := createTestUser(t, c)
+		video := createTestVideo(t, c, CreateVideoParams{
+			Title:       "Boots",
+			Description: "a walk",
+			UserID:      userID,
+			Tags:        Tags{"outdoors", "walking"},
+			IsPublic:    true,
+		})
+
+		got, err := c.GetVideo(ctx, video.ID)
+		if err != nil {
+			t.Fatalf("GetVideo: %v", err)
+		}
+		if got.Title != "Boots" || got.Description != "a walk" || got.UserID != userID || !got.IsPublic {
+			t.Errorf("GetVideo = %+v", got)
+		}
+		if !slices.Equal(got.Tags, Tags{"outdoors", "walking"}) {
+			t.Errorf("tags = %v", got.Tags)
+		}
+		if got.Status != VideoStatusDraft {
+			t.Errorf("new video is %s", got.Status)
+		}
+
+		//CreateVideo returns the row as stored, with the database's defaults
+		if got.Version != video.Version || !got.CreatedAt.Equal(video.CreatedAt) || got.Status != video.Status {
+			t.Errorf("CreateVideo returned %+v, stored %+v", video, got)
+		}
+
+		if _, err := c.GetVideo(ctx, userID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetVideo of a missing video: %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestUpdateVideoVersions(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		video := createTestVideo(t, c, CreateVideoParams{Title: "v1", UserID: createTestUser(t, c)})
+
+		stale := video
+		video.Title = "v2"
+		saved, err := c.UpdateVideo(ctx, video)
+		if err != nil {
+			t.Fatalf("UpdateVideo: %v", err)
+		}
+		if saved.Version != video.Version+1 || saved.Title != "v2" {
+			t.Errorf("saved version %d titled %q, want version %d", saved.Version, saved.Title, video.Version+1)
+		}
+		if !saved.UpdatedAt.After(video.UpdatedAt) {
+			t.Errorf("updated_at didn't move: %v then %v", video.UpdatedAt, saved.UpdatedAt)
+		}
+
+		stale.Title = "lost"
+		if _, err := c.UpdateVideo(ctx, stale); !errors.Is(err, ErrVersionConflict) {
+			t.Errorf("UpdateVideo of a stale version: %v, want ErrVersionConflict", err)
+		}
+
+		//ModifyVideo reapplies the change to whatever is current
+		modified, err := c.ModifyVideo(ctx, video.ID, func(v *Video) error {
+			v.Description = "changed"
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ModifyVideo: %v", err)
+		}
+		if modified.Title != "v2" || modified.Description != "changed" || modified.Version != saved.Version+1 {
+			t.Errorf("ModifyVideo = %+v", modified)
+		}
+
+		changeErr := errors.New("nope")
+		if _, err := c.ModifyVideo(ctx, video.ID, func(v *Video) error { return changeErr }); !errors.Is(err, changeErr) {
+			t.Errorf("ModifyVideo returned %v, want the change's error", err)
+		}
+	})
+}
+
+func TestUpdateVideoQueuesDroppedMedia(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		video := createTestVideo(t, c, CreateVideoParams{Title: "media", UserID: createTestUser(t, c)})
+
+		old, replacement := "thumbnails/old.png", "thumbnails/new.png"
+		video.ThumbnailURL = &old
+		video, err := c.UpdateVideo(ctx, video)
+		if err != nil {
+			t.Fatal(err)
+		}
+		video.ThumbnailURL = &replacement
+		if _, err := c.UpdateVideo(ctx, video); err != nil {
+			t.Fatal(err)
+		}
+
+		deletions, err := c.GetDueStorageDeletions(ctx, 10)
+		if err != nil {
+			t.Fatalf("GetDueStorageDeletions: %v", err)
+		}
+		if len(deletions) != 1 || deletions[0].Ref != old {
+			t.Fatalf("queued deletions = %+v, want only %s", deletions, old)
+		}
+
+		if err := c.DeleteVideo(ctx, video.ID); err != nil {
+			t.Fatalf("DeleteVideo: %v", err)
+		}
+		deletions, err = c.GetDueStorageDeletions(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deletions) != 2 {
+			t.Errorf("deleting the video queued %d deletions, want both thumbnails", len(deletions))
+		}
+		if err := c.DeleteVideo(ctx, video.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("deleting twice: %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestVideoStatusTransitions(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		video := createTestVideo(t, c, CreateVideoParams{Title: "status", UserID: createTestUser(t, c)})
+
+		if _, err := c.TransitionVideoStatus(ctx, video.ID, VideoStatusReady, ""); !errors.Is(err, ErrInvalidVideoTransition) {
+			t.Errorf("draft to ready: %v, want ErrInvalidVideoTransition", err)
+		}
+		for _, status := range []VideoStatus{VideoStatusUploading, VideoStatusProcessing, VideoStatusFailed} {
+			moved, err := c.TransitionVideoStatus(ctx, video.ID, status, "broken")
+			if err != nil {
+				t.Fatalf("moving to %s: %v", status, err)
+			}
+			if moved.Status != status || moved.Version <= video.Version {
+				t.Errorf("moved to %s at version %d", moved.Status, moved.Version)
+			}
+			video = moved
+		}
+		if video.FailureReason == nil || *video.FailureReason != "broken" {
+			t.Errorf("failure reason = %v", video.FailureReason)
+		}
+	})
+}
+
+func TestTrashAndPurge(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		userID := createTestUser(t, c)
+		video := createTestVideo(t, c, CreateVideoParams{Title: "trash", UserID: userID})
+		video, err := c.ModifyVideo(ctx, video.ID, func(v *Video) error {
+			videoRef, thumbnailRef, hlsRef := "b,landscape/a.mp4", "b,thumbnails/a/orig.jpg", "b,hls/a/master.m3u8"
+			v.VideoURL, v.ThumbnailURL, v.HLSURL = &videoRef, &thumbnailRef, &hlsRef
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		before := time.Now().Add(-time.Second)
+		if err := c.TrashVideo(ctx, video.ID); err != nil {
+			t.Fatalf("TrashVideo: %v", err)
+		}
+		if _, err := c.GetVideo(ctx, video.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetVideo of a trashed video: %v, want ErrNotFound", err)
+		}
+		trashed, err := c.GetTrashedVideos(ctx, userID)
+		if err != nil || len(trashed) != 1 {
+			t.Fatalf("GetTrashedVideos = %d videos: %v", len(trashed), err)
+		}
+		if deletedAt := trashed[0].DeletedAt; deletedAt == nil || deletedAt.Before(before) || deletedAt.After(time.Now().Add(time.Second)) {
+			t.Errorf("deleted_at = %v, want about now", deletedAt)
+		}
+
+		if err := c.RestoreVideo(ctx, video.ID); err != nil {
+			t.Fatalf("RestoreVideo: %v", err)
+		}
+		restored, err := c.GetVideo(ctx, video.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restored.Version <= video.Version || restored.DeletedAt != nil {
+			t.Errorf("trashing and restoring left version %d, deleted_at %v", restored.Version, restored.DeletedAt)
+		}
+		if _, err := c.GetTrashedVideo(ctx, video.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("restored video is still in the trash: %v", err)
+		}
+		//restoring keeps the media, nothing gets deleted
+		if deletions, err := c.GetDueStorageDeletions(ctx, 10); err != nil || len(deletions) != 0 {
+			t.Errorf("restoring queued %d deletions: %v", len(deletions), err)
+		}
+
+		if err := c.TrashVideo(ctx, video.ID); err != nil {
+			t.Fatal(err)
+		}
+		//a cutoff before the trashing keeps the video, one after it purges it
+		if n, err := c.PurgeTrashedVideos(ctx, before); err != nil || n != 0 {
+			t.Errorf("early purge removed %d videos: %v", n, err)
+		}
+		if deletions, err := c.GetDueStorageDeletions(ctx, 10); err != nil || len(deletions) != 0 {
+			t.Errorf("early purge queued %d deletions: %v", len(deletions), err)
+		}
+		if n, err := c.PurgeTrashedVideos(ctx, time.Now().Add(time.Second)); err != nil || n != 1 {
+			t.Errorf("purge removed %d videos: %v", n, err)
+		}
+		if _, err := c.GetTrashedVideo(ctx, video.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("purged video is still in the trash: %v", err)
+		}
+
+		//purging queues all of the video's media for deletion
+		deletions, err := c.GetDueStorageDeletions(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		queued := []MediaRef{}
+		for _, deletion := range deletions {
+			queued = append(queued, deletion.MediaRef)
+		}
+		want := video.MediaRefs()
+		slices.SortFunc(queued, func(a, b MediaRef) int { return strings.Compare(a.Ref, b.Ref) })
+		slices.SortFunc(want, func(a, b MediaRef) int { return strings.Compare(a.Ref, b.Ref) })
+		if !slices.Equal(queued, want) {
+			t.Errorf("queued %+v, want %+v", queued, want)
+		}
+	})
+}
+
+func TestQueueStorageDeletions(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		refs := []MediaRef{{Ref: "b,thumbnails/a/320w.jpg", Kind: MediaObject}, {Ref: "b,hls/a/master.m3u8", Kind: MediaHLS}}
+		if err := c.QueueStorageDeletions(ctx, refs); err != nil {
+			t.Fatalf("QueueStorageDeletions: %v", err)
+		}
+		deletions, err := c.GetDueStorageDeletions(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		queued := []MediaRef{}
+		for _, deletion := range deletions {
+			queued = append(queued, deletion.MediaRef)
+		}
+		slices.SortFunc(queued, func(a, b MediaRef) int { return strings.Compare(b.Ref, a.Ref) })
+		if !slices.Equal(queued, refs) {
+			t.Errorf("queued %+v, want %+v", queued, refs)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+)
+
+// DefaultWidths are the rendition widths produced for thumbnails.
+var DefaultWidths = []int{320, 640, 1280}
+
+// Rendition is one resized, JPEG encoded version of an image.
+type Rendition struct {
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// Decode reads a PNG or JPEG image and turns it upright according to its
+// EXIF orientation. Metadata is not carried over to anything encoded from
+// the result.
+func Decode(data []byte) (image.Image, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode image: %w", err)
+	}
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	return img, nil
+}
+
+// Renditions scales img down to each of widths, keeping the aspect ratio, and
+// encodes the results as JPEG. Widths larger than the image are skipped, but
+// at least one rendition at the original size is always returned.
+func Renditions(img image.Image, widths []int, quality int) ([]Rendition, error) {
+	srcW := img.Bounds().Dx()
+	renditions := []Rendition{}
+	for _, width := range widths {
+		if width > srcW {
+			continue
+		}
+		r, err := encodeRendition(img, width, quality)
+		if err != nil {
+			return nil, err
+		}
+		renditions = append(renditions, r)
+	}
+	if len(renditions) == 0 {
+		r, err := encodeRendition(img, srcW, quality)
+		if err != nil {
+			return nil, err
+		}
+		renditions = append(renditions, r)
+	}
+	return renditions, nil
+}
+
+func encodeRendition(img image.Image, width, quality int) (Rendition, error) {
+	resized := Resize(img, width)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, resized, &jpeg.Options{Quality: quality}); err != nil {
+		return Rendition{}, fmt.Errorf("couldn't encode %dw rendition: %w", width, err)
+	}
+	return Rendition{
+		Width:  resized.Bounds().Dx(),
+		Height: resized.Bounds().Dy(),
+		Data:   buf.Bytes(),
+	}, nil
+}
+
+// Resize scales img to width pixels wide, keeping the aspect ratio.
+func Resize(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	height := max(1, b.Dy()*width/b.Dx())
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
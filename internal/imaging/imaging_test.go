@@ -0,0 +1,142 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"slices"
+	"testing"
+)
+
+// withOrientation inserts an APP1 EXIF segment with the orientation tag
+// right after the SOI marker of jpegData.
+func withOrientation(t *testing.T, jpegData []byte, order binary.AppendByteOrder, orientation int) []byte {
+	t.Helper()
+	tiff := []byte("II*\x00")
+	if order == binary.BigEndian {
+		tiff = []byte("MM\x00*")
+	}
+	tiff = order.AppendUint32(tiff, 8)
+	tiff = order.AppendUint16(tiff, 1)
+	tiff = order.AppendUint16(tiff, 0x0112)
+	tiff = order.AppendUint16(tiff, 3)
+	tiff = order.AppendUint32(tiff, 1)
+	tiff = order.AppendUint16(tiff, uint16(orientation))
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := binary.BigEndian.AppendUint16([]byte{0xFF, 0xE1}, uint16(2+len(segment)))
+	app1 = append(app1, segment...)
+	return slices.Concat(jpegData[:2], app1, jpegData[2:])
+}
+
+func encodeJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	plain := encodeJPEG(t, 4, 2)
+	if got := jpegOrientation(plain); got != 1 {
+		t.Errorf("jpegOrientation without EXIF = %d, want 1", got)
+	}
+	for _, order := range []binary.AppendByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for orientation := 1; orientation <= 8; orientation++ {
+			if got := jpegOrientation(withOrientation(t, plain, order, orientation)); got != orientation {
+				t.Errorf("%v jpegOrientation = %d, want %d", order, got, orientation)
+			}
+		}
+		if got := jpegOrientation(withOrientation(t, plain, order, 9)); got != 1 {
+			t.Errorf("%v jpegOrientation of an invalid value = %d, want 1", order, got)
+		}
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	//a 3x2 image with its first row marked, as stored by the camera
+	red := color.RGBA{255, 0, 0, 255}
+	green := color.RGBA{0, 255, 0, 255}
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	src.Set(0, 0, red)
+	src.Set(1, 0, green)
+
+	tests := []struct {
+		orientation int
+		size        image.Point
+		red, green  image.Point
+	}{
+		{1, image.Pt(3, 2), image.Pt(0, 0), image.Pt(1, 0)},
+		{2, image.Pt(3, 2), image.Pt(2, 0), image.Pt(1, 0)},
+		{3, image.Pt(3, 2), image.Pt(2, 1), image.Pt(1, 1)},
+		{4, image.Pt(3, 2), image.Pt(0, 1), image.Pt(1, 1)},
+		{5, image.Pt(2, 3), image.Pt(0, 0), image.Pt(0, 1)},
+		{6, image.Pt(2, 3), image.Pt(1, 0), image.Pt(1, 1)},
+		{7, image.Pt(2, 3), image.Pt(1, 2), image.Pt(1, 1)},
+		{8, image.Pt(2, 3), image.Pt(0, 2), image.Pt(0, 1)},
+	}
+	for _, tt := range tests {
+		got := applyOrientation(src, tt.orientation)
+		if size := got.Bounds().Size(); size != tt.size {
+			t.Errorf("orientation %d: size = %v, want %v", tt.orientation, size, tt.size)
+			continue
+		}
+		if c := color.RGBAModel.Convert(got.At(tt.red.X, tt.red.Y)); c != red {
+			t.Errorf("orientation %d: red pixel isn't at %v", tt.orientation, tt.red)
+		}
+		if c := color.RGBAModel.Convert(got.At(tt.green.X, tt.green.Y)); c != green {
+			t.Errorf("orientation %d: green pixel isn't at %v", tt.orientation, tt.green)
+		}
+	}
+}
+
+func TestDecodeAppliesOrientation(t *testing.T) {
+	rotated := withOrientation(t, encodeJPEG(t, 40, 20), binary.BigEndian, 6)
+	img, err := Decode(rotated)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(20, 40) {
+		t.Errorf("size = %v, want 20x40", size)
+	}
+}
+
+func TestRenditions(t *testing.T) {
+	tests := []struct {
+		name       string
+		width      int
+		wantWidths []int
+	}{
+		{"larger than every width", 1920, []int{320, 640, 1280}},
+		{"exactly the largest width", 1280, []int{320, 640, 1280}},
+		{"between widths", 800, []int{320, 640}},
+		{"smaller than every width", 200, []int{200}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewGray(image.Rect(0, 0, tt.width, tt.width/2))
+			renditions, err := Renditions(img, DefaultWidths, 80)
+			if err != nil {
+				t.Fatalf("Renditions: %v", err)
+			}
+			widths := []int{}
+			for _, r := range renditions {
+				widths = append(widths, r.Width)
+				if r.Height != r.Width/2 {
+					t.Errorf("%dw rendition is %d high, want %d", r.Width, r.Height, r.Width/2)
+				}
+				if _, err := jpeg.Decode(bytes.NewReader(r.Data)); err != nil {
+					t.Errorf("%dw rendition isn't a jpeg: %v", r.Width, err)
+				}
+			}
+			if !slices.Equal(widths, tt.wantWidths) {
+				t.Errorf("widths = %v, want %v", widths, tt.wantWidths)
+			}
+		})
+	}
+}
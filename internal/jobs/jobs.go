@@ -0,0 +1,226 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// Handler does the work for one job. Returning an error schedules a retry
+// until the job runs out of attempts.
+type Handler func(ctx context.Context, job database.Job) error
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, so the job is dead lettered
+// right away.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Config controls how a Runner polls for and retries jobs.
+type Config struct {
+	// Workers is the number of jobs run at the same time.
+	Workers int
+	// PollInterval is how long an idle worker waits before looking for
+	// new jobs.
+	PollInterval time.Duration
+	// Lease is how long a claimed job stays invisible to other workers.
+	// Running jobs renew it until they finish.
+	Lease time.Duration
+	// BaseBackoff is the delay before the first retry, doubled for every
+	// further attempt up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// DefaultConfig is used for any zero fields of the Config given to NewRunner.
+var DefaultConfig = Config{
+	Workers:      2,
+	PollInterval: time.Second,
+	Lease:        time.Minute,
+	BaseBackoff:  5 * time.Second,
+	MaxBackoff:   time.Hour,
+}
+
+// Runner runs queued jobs from the jobs table with a pool of workers, using
+// the handler registered for their type.
+type Runner struct {
+	db       database.Client
+	handlers map[string]Handler
+	config   Config
+}
+
+func NewRunner(db database.Client, config Config) *Runner {
+	if config.Workers <= 0 {
+		config.Workers = DefaultConfig.Workers
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultConfig.PollInterval
+	}
+	if config.Lease <= 0 {
+		config.Lease = DefaultConfig.Lease
+	}
+	if config.BaseBackoff <= 0 {
+		config.BaseBackoff = DefaultConfig.BaseBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultConfig.MaxBackoff
+	}
+	return &Runner{
+		db:       db,
+		handlers: map[string]Handler{},
+		config:   config,
+	}
+}
+
+// Register sets the handler for a job type. It must be called before Run.
+func (r *Runner) Register(jobType string, handler Handler) {
+	r.handlers[jobType] = handler
+}
+
+// Enqueue stores a job of the given type with payload encoded as JSON.
+func Enqueue(ctx context.Context, db database.Client, jobType string, payload any, userID *uuid.UUID) (database.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return database.Job{}, fmt.Errorf("couldn't encode %s payload: %w", jobType, err)
+	}
+	return db.EnqueueJob(ctx, database.EnqueueJobParams{
+		Type:    jobType,
+		Payload: string(data),
+		UserID:  userID,
+	})
+}
+
+// Run processes jobs until ctx is cancelled and every worker has finished
+// its current job.
+func (r *Runner) Run(ctx context.Context) {
+	hostname, _ := os.Hostname()
+
+	var wg sync.WaitGroup
+	for i := range r.config.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.work(ctx, fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), i))
+		}()
+	}
+	wg.Wait()
+}
+
+func (r *Runner) work(ctx context.Context, owner string) {
+	for ctx.Err() == nil {
+		job, err := r.db.ClaimJob(ctx, owner, r.config.Lease)
+		if err != nil {
+			log.Printf("couldn't claim job: %v", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(r.config.PollInterval):
+			}
+			continue
+		}
+		r.runJob(ctx, owner, *job)
+	}
+}
+
+func (r *Runner) runJob(ctx context.Context, owner string, job database.Job) {
+	handler, ok := r.handlers[job.Type]
+	if !ok {
+		r.fail(ctx, owner, job, Permanent(fmt.Errorf("no handler for job type %q", job.Type)))
+		return
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		r.renewLease(jobCtx, cancel, owner, job)
+	}()
+
+	log.Printf("running %s job %s (attempt %d/%d)", job.Type, job.ID, job.Attempts, job.MaxAttempts)
+	err := handler(jobCtx, job)
+	//the lease must not be renewed after the job is reported
+	cancel()
+	<-renewed
+
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		//shutting down, the job is picked up again when the lease runs out
+		return
+	}
+	//reporting outlives a shutdown that started after the job finished
+	ctx = context.WithoutCancel(ctx)
+	if err != nil {
+		r.fail(ctx, owner, job, err)
+		return
+	}
+	if err := r.db.CompleteJob(ctx, job.ID, owner); err != nil {
+		log.Printf("couldn't mark job %s complete: %v", job.ID, err)
+	}
+}
+
+// renewLease extends the job's lease while it runs. If the lease is lost
+// another worker may already be running the job, so this one is cancelled.
+func (r *Runner) renewLease(ctx context.Context, cancel context.CancelFunc, owner string, job database.Job) {
+	ticker := time.NewTicker(r.config.Lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := r.db.ExtendJobLease(ctx, job.ID, owner, r.config.Lease)
+			if errors.Is(err, database.ErrJobLeaseLost) {
+				log.Printf("lost lease on %s job %s", job.Type, job.ID)
+				cancel()
+				return
+			}
+			if err != nil {
+				log.Printf("couldn't extend lease on job %s: %v", job.ID, err)
+			}
+		}
+	}
+}
+
+func (r *Runner) fail(ctx context.Context, owner string, job database.Job, jobErr error) {
+	var permanent *permanentError
+	if errors.As(jobErr, &permanent) || job.Attempts >= job.MaxAttempts {
+		log.Printf("%s job %s dead lettered: %v", job.Type, job.ID, jobErr)
+		if err := r.db.DeadLetterJob(ctx, job.ID, owner, jobErr.Error()); err != nil {
+			log.Printf("couldn't dead letter job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	delay := r.backoff(job.Attempts)
+	log.Printf("%s job %s failed, retrying in %s: %v", job.Type, job.ID, delay, jobErr)
+	if err := r.db.RetryJob(ctx, job.ID, owner, jobErr.Error(), time.Now().Add(delay)); err != nil {
+		log.Printf("couldn't schedule retry of job %s: %v", job.ID, err)
+	}
+}
+
+// backoff returns the delay before retrying after the given attempt, with
+// up to 20% jitter so failing jobs don't retry in lockstep.
+func (r *Runner) backoff(attempt int) time.Duration {
+	delay := r.config.BaseBackoff
+	for i := 1; i < attempt && delay < r.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, r.config.MaxBackoff)
+	return delay + rand.N(delay/5+1)
+}
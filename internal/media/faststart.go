@@ -0,0 +1,126 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// ErrFFmpegUnavailable is returned by FastStart when a file needs remuxing
+// but ffmpeg isn't installed.
+var ErrFFmpegUnavailable = errors.New("ffmpeg is not available to remux the video")
+
+// FastStart makes sure the MP4 at inputPath has its moov atom before the
+// media data, so playback can start before the whole file is downloaded.
+// It returns the path of the file to upload: inputPath itself when it is
+// already fast-start, otherwise a new temp file the caller must remove.
+func FastStart(ctx context.Context, inputPath string) (string, error) {
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return "", err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return "", err
+	}
+	fastStart, err := IsFastStart(f, stat.Size())
+	f.Close()
+	if err != nil {
+		return "", err
+	}
+	if fastStart {
+		return inputPath, nil
+	}
+
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return "", ErrFFmpegUnavailable
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(inputPath), "tubely-faststart-*.mp4")
+	if err != nil {
+		return "", err
+	}
+	outputPath := out.Name()
+	out.Close()
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-y", "-v", "error",
+		"-i", inputPath,
+		"-c", "copy",
+		"-movflags", "faststart",
+		"-f", "mp4",
+		outputPath,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(outputPath)
+		return "", fmt.Errorf("ffmpeg remux failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return outputPath, nil
+}
+
+// Box is a top-level MP4 box.
+type Box struct {
+	Type   string
+	Offset int64
+	Size   int64
+}
+
+// TopLevelBoxes walks the top-level boxes of an MP4 file, failing if any
+// box header is truncated or claims to extend past the end of the file.
+func TopLevelBoxes(r io.ReaderAt, size int64) ([]Box, error) {
+	boxes := []Box{}
+	var offset int64
+	header := make([]byte, 16)
+	for offset < size {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, fmt.Errorf("invalid mp4: couldn't read box header at %d: %w", offset, err)
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+		headerSize := int64(8)
+
+		switch boxSize {
+		case 0:
+			// the box extends to the end of the file
+			boxSize = size - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, fmt.Errorf("invalid mp4: couldn't read large box size at %d: %w", offset, err)
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if boxSize < headerSize || offset+boxSize > size {
+			return nil, fmt.Errorf("invalid mp4: box %q at %d has bad size %d", boxType, offset, boxSize)
+		}
+
+		boxes = append(boxes, Box{Type: boxType, Offset: offset, Size: boxSize})
+		offset += boxSize
+	}
+	return boxes, nil
+}
+
+// IsFastStart reports whether the moov box comes before the mdat box.
+func IsFastStart(r io.ReaderAt, size int64) (bool, error) {
+	boxes, err := TopLevelBoxes(r, size)
+	if err != nil {
+		return false, err
+	}
+	for _, box := range boxes {
+		switch box.Type {
+		case "moov":
+			return true, nil
+		case "mdat":
+			return false, nil
+		}
+	}
+	return false, errors.New("invalid mp4: no moov or mdat box found")
+}
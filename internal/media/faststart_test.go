@@ -0,0 +1,115 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+// box encodes an MP4 box with a 32-bit size.
+func box(typ string, payloadSize int) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+payloadSize))
+	return append(append(b, typ...), make([]byte, payloadSize)...)
+}
+
+// largeBox encodes an MP4 box with a 64-bit largesize.
+func largeBox(typ string, payloadSize int) []byte {
+	b := binary.BigEndian.AppendUint32(nil, 1)
+	b = append(b, typ...)
+	b = binary.BigEndian.AppendUint64(b, uint64(16+payloadSize))
+	return append(b, make([]byte, payloadSize)...)
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestTopLevelBoxes(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []Box
+		wantErr bool
+	}{
+		{
+			name: "moov before mdat",
+			data: concat(box("ftyp", 16), box("moov", 40), box("mdat", 100)),
+			want: []Box{{"ftyp", 0, 24}, {"moov", 24, 48}, {"mdat", 72, 108}},
+		},
+		{
+			name: "largesize mdat",
+			data: concat(box("ftyp", 16), largeBox("mdat", 100), box("moov", 40)),
+			want: []Box{{"ftyp", 0, 24}, {"mdat", 24, 116}, {"moov", 140, 48}},
+		},
+		{
+			name: "size 0 runs to the end",
+			data: concat(box("ftyp", 16), box("moov", 40), []byte{0, 0, 0, 0}, []byte("mdat"), make([]byte, 50)),
+			want: []Box{{"ftyp", 0, 24}, {"moov", 24, 48}, {"mdat", 72, 58}},
+		},
+		{
+			name:    "truncated header",
+			data:    concat(box("ftyp", 16), []byte{0, 0, 0}),
+			wantErr: true,
+		},
+		{
+			name:    "box past the end",
+			data:    concat(box("ftyp", 16), box("moov", 40)[:30]),
+			wantErr: true,
+		},
+		{
+			name:    "truncated largesize",
+			data:    concat(box("ftyp", 16), largeBox("mdat", 0)[:12]),
+			wantErr: true,
+		},
+		{
+			name:    "size smaller than its header",
+			data:    concat(box("ftyp", 16), []byte{0, 0, 0, 4}, []byte("moov")),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TopLevelBoxes(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("TopLevelBoxes = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("TopLevelBoxes = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("TopLevelBoxes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsFastStart(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    bool
+		wantErr bool
+	}{
+		{"moov before mdat", concat(box("ftyp", 16), box("moov", 40), box("mdat", 100)), true, false},
+		{"moov after mdat", concat(box("ftyp", 16), box("mdat", 100), box("moov", 40)), false, false},
+		{"largesize mdat first", concat(box("ftyp", 16), largeBox("mdat", 100), box("moov", 40)), false, false},
+		{"largesize moov first", concat(box("ftyp", 16), largeBox("moov", 40), largeBox("mdat", 100)), true, false},
+		{"neither box", concat(box("ftyp", 16), box("free", 8)), false, true},
+		{"truncated", concat(box("ftyp", 16), box("moov", 40))[:50], false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := IsFastStart(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("IsFastStart error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("IsFastStart = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Rung is one variant of an HLS bitrate ladder.
+type Rung struct {
+	Height       int
+	VideoBitrate int // kbit/s
+	AudioBitrate int // kbit/s
+}
+
+var DefaultLadder = []Rung{
+	{Height: 360, VideoBitrate: 800, AudioBitrate: 96},
+	{Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+	{Height: 1080, VideoBitrate: 5000, AudioBitrate: 192},
+}
+
+const MasterPlaylist = "master.m3u8"
+
+// TranscodeHLS encodes the video at inputPath into an HLS variant per rung
+// of the ladder that isn't taller than the source, each in its own
+// <height>p directory below outDir, and writes outDir/master.m3u8.
+func TranscodeHLS(ctx context.Context, inputPath, outDir string, info VideoInfo, ladder []Rung) error {
+	rungs := []Rung{}
+	for _, rung := range ladder {
+		if rung.Height <= shortSide(info) {
+			rungs = append(rungs, rung)
+		}
+	}
+	if len(rungs) == 0 && len(ladder) > 0 {
+		rungs = ladder[:1]
+	}
+
+	var master strings.Builder
+	master.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, rung := range rungs {
+		name := fmt.Sprintf("%dp", rung.Height)
+		if err := os.MkdirAll(filepath.Join(outDir, name), 0755); err != nil {
+			return err
+		}
+
+		width, height := rungSize(info, rung.Height)
+		cmd := exec.CommandContext(ctx, "ffmpeg", "-v", "error",
+			"-i", inputPath,
+			"-map", "0:v:0",
+			"-map", "0:a:0?",
+			"-vf", fmt.Sprintf("scale=%d:%d", width, height),
+			"-c:v", "libx264",
+			"-preset", "veryfast",
+			"-profile:v", "main",
+			"-b:v", fmt.Sprintf("%dk", rung.VideoBitrate),
+			"-maxrate", fmt.Sprintf("%dk", rung.VideoBitrate*107/100),
+			"-bufsize", fmt.Sprintf("%dk", rung.VideoBitrate*3/2),
+			"-c:a", "aac",
+			"-b:a", fmt.Sprintf("%dk", rung.AudioBitrate),
+			"-hls_time", "6",
+			"-hls_playlist_type", "vod",
+			"-hls_segment_filename", filepath.Join(outDir, name, "segment_%04d.ts"),
+			filepath.Join(outDir, name, "index.m3u8"),
+		)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("ffmpeg %s transcode failed: %w: %s", name, err, bytes.TrimSpace(stderr.Bytes()))
+		}
+
+		bandwidth := (rung.VideoBitrate + rung.AudioBitrate) * 1000
+		fmt.Fprintf(&master, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n%s/index.m3u8\n", bandwidth, width, height, name)
+	}
+
+	return os.WriteFile(filepath.Join(outDir, MasterPlaylist), []byte(master.String()), 0644)
+}
+
+// ContentType returns the media type of a file produced by TranscodeHLS.
+func ContentType(name string) string {
+	switch filepath.Ext(name) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".ts":
+		return "video/mp2t"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+func shortSide(info VideoInfo) int {
+	return min(info.Width, info.Height)
+}
+
+// rungSize scales the source so its short side matches the rung's height,
+// keeping both dimensions even as libx264 requires.
+func rungSize(info VideoInfo, size int) (int, int) {
+	if info.Width == 0 || info.Height == 0 {
+		return size * 16 / 9 &^ 1, size
+	}
+	if info.Width >= info.Height {
+		return (size*info.Width/info.Height + 1) &^ 1, size
+	}
+	return size, (size*info.Height/info.Width + 1) &^ 1
+}
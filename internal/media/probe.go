@@ -0,0 +1,168 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+const (
+	OrientationLandscape = "landscape"
+	OrientationPortrait  = "portrait"
+	OrientationOther     = "other"
+)
+
+// VideoInfo is what ffprobe reports about the first video stream of a file.
+type VideoInfo struct {
+	Width    int
+	Height   int
+	Duration float64
+	Codec    string
+}
+
+// Probe runs ffprobe against the file at path and returns the properties of
+// its first video stream.
+func Probe(ctx context.Context, path string) (VideoInfo, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-print_format", "json", "-show_streams", path)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return VideoInfo{}, fmt.Errorf("ffprobe failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return parseProbeOutput(stdout.Bytes())
+}
+
+type probeStream struct {
+	CodecType string `json:"codec_type"`
+	CodecName string `json:"codec_name"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Duration  string `json:"duration"`
+	Tags      struct {
+		Rotate string `json:"rotate"`
+	} `json:"tags"`
+	SideDataList []struct {
+		Rotation float64 `json:"rotation"`
+	} `json:"side_data_list"`
+}
+
+// parseProbeOutput reads the first video stream from ffprobe's JSON output.
+// Width and Height are the dimensions the video is displayed at, so they
+// are swapped for streams rotated by 90 or 270 degrees.
+func parseProbeOutput(data []byte) (VideoInfo, error) {
+	var output struct {
+		Streams []probeStream `json:"streams"`
+	}
+	if err := json.Unmarshal(data, &output); err != nil {
+		return VideoInfo{}, fmt.Errorf("couldn't parse ffprobe output: %w", err)
+	}
+
+	for _, stream := range output.Streams {
+		if stream.CodecType != "video" {
+			continue
+		}
+		info := VideoInfo{
+			Width:  stream.Width,
+			Height: stream.Height,
+			Codec:  stream.CodecName,
+		}
+		if rotation := stream.rotation(); rotation == 90 || rotation == 270 {
+			info.Width, info.Height = info.Height, info.Width
+		}
+		if stream.Duration != "" {
+			info.Duration, _ = strconv.ParseFloat(stream.Duration, 64)
+		}
+		return info, nil
+	}
+	return VideoInfo{}, errors.New("no video stream found")
+}
+
+// rotation returns the stream's display rotation in degrees between 0 and
+// 359. Newer ffprobe versions report it as display matrix side data, older
+// ones as a rotate tag.
+func (s probeStream) rotation() int {
+	degrees := 0
+	for _, sideData := range s.SideDataList {
+		if sideData.Rotation != 0 {
+			degrees = int(math.Round(sideData.Rotation))
+			break
+		}
+	}
+	if degrees == 0 && s.Tags.Rotate != "" {
+		degrees, _ = strconv.Atoi(s.Tags.Rotate)
+	}
+	return (degrees%360 + 360) % 360
+}
+
+// maxMetadataSize caps how much of a file ProbeReader reads.
+const maxMetadataSize = 64 << 20
+
+// ProbeReader probes the MP4 in r without reading its media data. Every
+// top-level box but mdat is copied to the same offset of a sparse temp file
+// of the same size, which ffprobe reads like the original.
+func ProbeReader(ctx context.Context, r io.ReaderAt, size int64) (VideoInfo, error) {
+	boxes, err := TopLevelBoxes(r, size)
+	if err != nil {
+		return VideoInfo{}, err
+	}
+
+	f, err := os.CreateTemp("", "tubely-probe-*.mp4")
+	if err != nil {
+		return VideoInfo{}, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := f.Truncate(size); err != nil {
+		return VideoInfo{}, err
+	}
+
+	var copied int64
+	for _, box := range boxes {
+		n := box.Size
+		if box.Type == "mdat" {
+			//only the header, so the boxes after it are found
+			n = min(n, 16)
+		}
+		copied += n
+		if copied > maxMetadataSize {
+			return VideoInfo{}, fmt.Errorf("invalid mp4: more than %d bytes of metadata", maxMetadataSize)
+		}
+		data := make([]byte, n)
+		if _, err := r.ReadAt(data, box.Offset); err != nil && !(errors.Is(err, io.EOF) && box.Offset+n == size) {
+			return VideoInfo{}, fmt.Errorf("couldn't read box %q: %w", box.Type, err)
+		}
+		if _, err := f.WriteAt(data, box.Offset); err != nil {
+			return VideoInfo{}, err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return VideoInfo{}, err
+	}
+	return Probe(ctx, f.Name())
+}
+
+// Orientation classifies the video by its aspect ratio: 16:9 is landscape,
+// 9:16 is portrait and anything else is other.
+func (v VideoInfo) Orientation() string {
+	if v.Width == 0 || v.Height == 0 {
+		return OrientationOther
+	}
+	const tolerance = 0.05
+	ratio := float64(v.Width) / float64(v.Height)
+	switch {
+	case math.Abs(ratio-16.0/9.0) < tolerance:
+		return OrientationLandscape
+	case math.Abs(ratio-9.0/16.0) < tolerance:
+		return OrientationPortrait
+	default:
+		return OrientationOther
+	}
+}
@@ -0,0 +1,87 @@
+package media
+
+import (
+	"fmt"
+	"testing"
+)
+
+// probeJSON is ffprobe output for a file with an audio stream followed by a
+// video stream, with extra fields for the video stream spliced in.
+func probeJSON(width, height int, extra string) string {
+	return fmt.Sprintf(`{
+	"streams": [
+		{"index": 0, "codec_name": "aac", "codec_type": "audio", "duration": "10.010000"},
+		{"index": 1, "codec_name": "h264", "codec_type": "video", "width": %d, "height": %d, "duration": "10.000000"%s}
+	]
+}`, width, height, extra)
+}
+
+func TestParseProbeOutput(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string
+		wantWidth   int
+		wantHeight  int
+		orientation string
+	}{
+		{"1080p", probeJSON(1920, 1080, ""), 1920, 1080, OrientationLandscape},
+		{"480p rounded width", probeJSON(854, 480, ""), 854, 480, OrientationLandscape},
+		{"cropped a little", probeJSON(1920, 1064, ""), 1920, 1064, OrientationLandscape},
+		{"cropped too much", probeJSON(1920, 1000, ""), 1920, 1000, OrientationOther},
+		{"vertical", probeJSON(1080, 1920, ""), 1080, 1920, OrientationPortrait},
+		{"vertical 480p", probeJSON(480, 854, ""), 480, 854, OrientationPortrait},
+		{"4:3", probeJSON(640, 480, ""), 640, 480, OrientationOther},
+		{"square", probeJSON(1080, 1080, ""), 1080, 1080, OrientationOther},
+		{"no dimensions", probeJSON(0, 0, ""), 0, 0, OrientationOther},
+		{
+			"phone portrait, display matrix",
+			probeJSON(1920, 1080, `, "side_data_list": [{"side_data_type": "Display Matrix", "rotation": -90}]`),
+			1080, 1920, OrientationPortrait,
+		},
+		{
+			"phone portrait, rotate tag",
+			probeJSON(1920, 1080, `, "tags": {"rotate": "90"}`),
+			1080, 1920, OrientationPortrait,
+		},
+		{
+			"rotated to landscape",
+			probeJSON(1080, 1920, `, "tags": {"rotate": "270"}`),
+			1920, 1080, OrientationLandscape,
+		},
+		{
+			"upside down",
+			probeJSON(1920, 1080, `, "side_data_list": [{"side_data_type": "Display Matrix", "rotation": 180}]`),
+			1920, 1080, OrientationLandscape,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parseProbeOutput([]byte(tt.output))
+			if err != nil {
+				t.Fatalf("parseProbeOutput: %v", err)
+			}
+			if info.Width != tt.wantWidth || info.Height != tt.wantHeight {
+				t.Errorf("dimensions = %dx%d, want %dx%d", info.Width, info.Height, tt.wantWidth, tt.wantHeight)
+			}
+			if info.Codec != "h264" || info.Duration != 10 {
+				t.Errorf("codec %q duration %v, want the video stream's", info.Codec, info.Duration)
+			}
+			if got := info.Orientation(); got != tt.orientation {
+				t.Errorf("Orientation = %q, want %q", got, tt.orientation)
+			}
+		})
+	}
+}
+
+func TestParseProbeOutputErrors(t *testing.T) {
+	for name, output := range map[string]string{
+		"audio only":  `{"streams": [{"codec_name": "aac", "codec_type": "audio"}]}`,
+		"no streams":  `{"streams": []}`,
+		"not json":    `ffprobe: invalid data`,
+		"wrong types": `{"streams": [{"codec_type": "video", "width": "wide"}]}`,
+	} {
+		if _, err := parseProbeOutput([]byte(output)); err == nil {
+			t.Errorf("%s: parseProbeOutput didn't fail", name)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// ExtractFrame grabs the frame at offset from the video at path and returns
+// it encoded as JPEG.
+func ExtractFrame(ctx context.Context, path string, offset time.Duration) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-v", "error",
+		"-ss", strconv.FormatFloat(offset.Seconds(), 'f', 3, 64),
+		"-i", path,
+		"-frames:v", "1",
+		"-f", "image2",
+		"-c:v", "mjpeg",
+		"-q:v", "2",
+		"pipe:1",
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg frame extraction failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("no frame at %s", offset)
+	}
+	return stdout.Bytes(), nil
+}
+
+// ExtractBestFrame samples a few frames across the video and returns the
+// first one that isn't mostly black or a single flat color, falling back to
+// the most detailed frame it saw.
+func ExtractBestFrame(ctx context.Context, path string, duration float64) ([]byte, error) {
+	candidates := []float64{0.1, 0.25, 0.5, 0.75}
+	if duration <= 0 {
+		// without a duration only the very start is safe to seek to
+		candidates = []float64{0}
+		duration = 1
+	}
+
+	var best []byte
+	bestScore := -1.0
+	var lastErr error
+	for _, fraction := range candidates {
+		offset := time.Duration(fraction * duration * float64(time.Second))
+		frame, err := ExtractFrame(ctx, path, offset)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		brightness, contrast, err := frameStats(frame)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if brightness > 0.1 && contrast > 0.05 {
+			return frame, nil
+		}
+		if score := brightness + contrast; score > bestScore {
+			best, bestScore = frame, score
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("couldn't extract any frame: %w", lastErr)
+	}
+	return best, nil
+}
+
+// frameStats returns the mean luma and its standard deviation, both
+// normalized to 0-1, sampling the frame on a coarse grid.
+func frameStats(jpegData []byte) (float64, float64, error) {
+	img, err := jpeg.Decode(bytes.NewReader(jpegData))
+	if err != nil {
+		return 0, 0, err
+	}
+	bounds := img.Bounds()
+	step := max(1, min(bounds.Dx(), bounds.Dy())/64)
+
+	var sum, sumSq float64
+	var n int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			l := luma(img, x, y)
+			sum += l
+			sumSq += l * l
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, 0, nil
+	}
+	mean := sum / float64(n)
+	variance := sumSq/float64(n) - mean*mean
+	return mean, math.Sqrt(math.Max(variance, 0)), nil
+}
+
+func luma(img image.Image, x, y int) float64 {
+	r, g, b, _ := img.At(x, y).RGBA()
+	return (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 0xffff
+}
+
+// EncodeWebP converts a JPEG image to WebP with ffmpeg, which has to be
+// built with libwebp.
+func EncodeWebP(ctx context.Context, jpegData []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-v", "error",
+		"-f", "image2pipe",
+		"-c:v", "mjpeg",
+		"-i", "pipe:0",
+		"-c:v", "libwebp",
+		"-quality", "80",
+		"-f", "webp",
+		"pipe:1",
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(jpegData)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg webp encoding failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
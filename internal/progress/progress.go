@@ -0,0 +1,151 @@
+// Package progress fans out upload and processing progress of videos to
+// whoever is watching them.
+package progress
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Stage string
+
+const (
+	// StageReceiving counts bytes of the upload read from the client.
+	StageReceiving Stage = "receiving"
+	// StageProcessing covers validating, probing and remuxing, with
+	// Step saying which.
+	StageProcessing Stage = "processing"
+	// StageStoring counts bytes of the processed file sent to storage.
+	StageStoring Stage = "storing"
+	StageReady   Stage = "ready"
+	StageFailed  Stage = "failed"
+)
+
+type Event struct {
+	Stage Stage  `json:"stage"`
+	Step  string `json:"step,omitempty"`
+	Done  int64  `json:"bytes_done,omitempty"`
+	Total int64  `json:"bytes_total,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Final reports whether no more events follow for the current upload.
+func (e Event) Final() bool {
+	return e.Stage == StageReady || e.Stage == StageFailed
+}
+
+// subscriberBuffer is how many events a slow subscriber can fall behind
+// before older events are dropped.
+const subscriberBuffer = 16
+
+// Broker delivers events published for a video to its subscribers. It
+// remembers the last event of every video so new subscribers start from
+// the current state.
+type Broker struct {
+	mu     sync.Mutex
+	subs   map[uuid.UUID]map[chan Event]struct{}
+	last   map[uuid.UUID]Event
+	expiry map[uuid.UUID]time.Time
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subs:   map[uuid.UUID]map[chan Event]struct{}{},
+		last:   map[uuid.UUID]Event{},
+		expiry: map[uuid.UUID]time.Time{},
+	}
+}
+
+// lastEventTTL is how long the last event of a finished upload is kept.
+const lastEventTTL = 5 * time.Minute
+
+// Publish sends event to everyone subscribed to videoID. It never blocks:
+// subscribers that fall behind lose their oldest events.
+func (b *Broker) Publish(videoID uuid.UUID, event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.last[videoID] = event
+	delete(b.expiry, videoID)
+	if event.Final() {
+		b.expiry[videoID] = time.Now().Add(lastEventTTL)
+	}
+	b.expireLocked()
+
+	for ch := range b.subs[videoID] {
+		select {
+		case ch <- event:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- event
+		}
+	}
+}
+
+// Subscribe returns a channel of events for videoID, starting with the last
+// one published if there is one, and a function that ends the subscription.
+func (b *Broker) Subscribe(videoID uuid.UUID) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	if event, ok := b.last[videoID]; ok {
+		ch <- event
+	}
+	if b.subs[videoID] == nil {
+		b.subs[videoID] = map[chan Event]struct{}{}
+	}
+	b.subs[videoID][ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs[videoID], ch)
+		if len(b.subs[videoID]) == 0 {
+			delete(b.subs, videoID)
+		}
+	}
+}
+
+func (b *Broker) expireLocked() {
+	now := time.Now()
+	for id, at := range b.expiry {
+		if now.After(at) {
+			delete(b.last, id)
+			delete(b.expiry, id)
+		}
+	}
+}
+
+// reportInterval limits how often a Reader reports, so a fast copy doesn't
+// flood subscribers with events.
+const reportInterval = 250 * time.Millisecond
+
+// Reader calls report with the running byte count as r is read, at most
+// every reportInterval and once more at the end.
+type Reader struct {
+	r      io.Reader
+	n      int64
+	last   time.Time
+	report func(n int64)
+}
+
+func NewReader(r io.Reader, report func(n int64)) *Reader {
+	return &Reader{r: r, report: report}
+}
+
+func (pr *Reader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.n += int64(n)
+	if err == io.EOF || time.Since(pr.last) >= reportInterval {
+		pr.last = time.Now()
+		pr.report(pr.n)
+	}
+	return n, err
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps objects in memory. It is meant for tests and for
+// running the server without any persistent storage.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+	baseURL string
+}
+
+type memoryObject struct {
+	data []byte
+	info ObjectInfo
+}
+
+func NewMemoryStore(baseURL string) *MemoryStore {
+	return &MemoryStore{
+		objects: map[string]memoryObject{},
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("couldn't read body for %s: %w", key, err)
+	}
+	sum := md5.Sum(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = memoryObject{
+		data: data,
+		info: ObjectInfo{
+			Key:          key,
+			Size:         int64(len(data)),
+			ContentType:  contentType,
+			ETag:         hex.EncodeToString(sum[:]),
+			LastModified: time.Now().UTC(),
+		},
+	}
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, ObjectInfo{}, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return io.NopCloser(bytes.NewReader(obj.data)), obj.info, nil
+}
+
+func (s *MemoryStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	size := int64(len(obj.data))
+	start := min(offset, size)
+	end := min(offset+length, size)
+	return io.NopCloser(bytes.NewReader(obj.data[start:end])), nil
+}
+
+func (s *MemoryStore) Head(ctx context.Context, key string) (ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[key]
+	if !ok {
+		return ObjectInfo{}, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return obj.info, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	objects := []ObjectInfo{}
+	for key, obj := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, obj.info)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, nil
+}
+
+func (s *MemoryStore) URL(key string) string {
+	return s.baseURL + "/" + key
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3Store stores objects in a single S3 bucket.
+type S3Store struct {
+	client    *s3.Client
+	presign   *s3.PresignClient
+	bucket    string
+	region    string
+	multipart MultipartConfig
+}
+
+func NewS3Store(client *s3.Client, bucket, region string, multipart MultipartConfig) *S3Store {
+	return &S3Store{
+		client:    client,
+		presign:   s3.NewPresignClient(client),
+		bucket:    bucket,
+		region:    region,
+		multipart: multipart.withDefaults(),
+	}
+}
+
+// Put uploads objects up to one part in size with a single PutObject and
+// streams anything larger through the multipart API.
+func (s *S3Store) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	first := make([]byte, s.multipart.PartSize)
+	n, err := io.ReadFull(body, first)
+	switch {
+	case err == nil:
+		return s.putMultipart(ctx, key, first, body, contentType)
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		first = first[:n]
+	default:
+		return fmt.Errorf("couldn't read body for %s: %w", key, err)
+	}
+
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(first),
+		ContentLength: aws.Int64(int64(n)),
+		ContentType:   aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't put object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, ObjectInfo{}, s.wrapErr(key, err)
+	}
+	info := ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		ContentType:  aws.ToString(out.ContentType),
+		ETag:         aws.ToString(out.ETag),
+		LastModified: aws.ToTime(out.LastModified),
+	}
+	return out.Body, info, nil
+}
+
+func (s *S3Store) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		return nil, s.wrapErr(key, err)
+	}
+	return out.Body, nil
+}
+
+func (s *S3Store) Head(ctx context.Context, key string) (ObjectInfo, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return ObjectInfo{}, s.wrapErr(key, err)
+	}
+	return ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		ContentType:  aws.ToString(out.ContentType),
+		ETag:         aws.ToString(out.ETag),
+		LastModified: aws.ToTime(out.LastModified),
+	}, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return s.wrapErr(key, err)
+	}
+	return nil
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	objects := []ObjectInfo{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't list objects: %w", err)
+		}
+		for _, obj := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				ETag:         aws.ToString(obj.ETag),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
+
+// PresignGet returns a time-limited URL for reading key from the bucket.
+func (s *S3Store) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	req, err := s.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("couldn't presign %s: %w", key, err)
+	}
+	return req.URL, nil
+}
+
+// PresignPost returns a presigned POST form for uploading key directly to
+// the bucket, limited by policy.
+func (s *S3Store) PresignPost(ctx context.Context, key string, policy PostPolicy) (PresignedPost, error) {
+	req, err := s.presign.PresignPostObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, func(opts *s3.PresignPostOptions) {
+		opts.Expires = policy.Expires
+		opts.Conditions = []interface{}{
+			[]interface{}{"starts-with", "$key", policy.KeyPrefix},
+			[]interface{}{"content-length-range", policy.MinSize, policy.MaxSize},
+			map[string]string{"Content-Type": policy.ContentType},
+		}
+	})
+	if err != nil {
+		return PresignedPost{}, fmt.Errorf("couldn't presign post for %s: %w", key, err)
+	}
+
+	fields := req.Values
+	fields["Content-Type"] = policy.ContentType
+	return PresignedPost{
+		URL:    req.URL,
+		Fields: fields,
+	}, nil
+}
+
+func (s *S3Store) URL(key string) string {
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, s.region, key)
+}
+
+func (s *S3Store) wrapErr(key string, err error) error {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return fmt.Errorf("s3 request for %s failed: %w", key, err)
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// MinPartSize is the smallest part S3 accepts, except for the last one.
+	MinPartSize = 5 << 20
+	maxParts    = 10000
+)
+
+// MultipartConfig controls how S3Store splits large objects into parts.
+type MultipartConfig struct {
+	PartSize    int64
+	Concurrency int
+}
+
+func (c MultipartConfig) withDefaults() MultipartConfig {
+	if c.PartSize < MinPartSize {
+		c.PartSize = MinPartSize
+	}
+	if c.Concurrency < 1 {
+		c.Concurrency = 1
+	}
+	return c
+}
+
+// putMultipart streams body to S3 as a multipart upload, first holding the
+// already read first part. Up to Concurrency parts are uploaded at once. Any
+// failure, including ctx being cancelled, aborts the upload so S3 doesn't
+// keep the parts around.
+func (s *S3Store) putMultipart(ctx context.Context, key string, first []byte, body io.Reader, contentType string) error {
+	created, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't start multipart upload for %s: %w", key, err)
+	}
+	uploadID := created.UploadId
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		parts    []types.CompletedPart
+		firstErr error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	slots := make(chan struct{}, s.multipart.Concurrency)
+	uploadPart := func(number int32, data []byte) {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			fail(ctx.Err())
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			out, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:        aws.String(s.bucket),
+				Key:           aws.String(key),
+				UploadId:      uploadID,
+				PartNumber:    aws.Int32(number),
+				Body:          bytes.NewReader(data),
+				ContentLength: aws.Int64(int64(len(data))),
+			})
+			if err != nil {
+				fail(fmt.Errorf("couldn't upload part %d: %w", number, err))
+				return
+			}
+			mu.Lock()
+			parts = append(parts, types.CompletedPart{
+				ETag:       out.ETag,
+				PartNumber: aws.Int32(number),
+			})
+			mu.Unlock()
+		}()
+	}
+
+	uploadPart(1, first)
+	for number := int32(2); ctx.Err() == nil; number++ {
+		buf := make([]byte, s.multipart.PartSize)
+		n, err := io.ReadFull(body, buf)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			fail(fmt.Errorf("couldn't read part %d: %w", number, err))
+			break
+		}
+		if number > maxParts {
+			fail(fmt.Errorf("object needs more than %d parts, increase the part size", maxParts))
+			break
+		}
+		uploadPart(number, buf[:n])
+		if n < len(buf) {
+			break
+		}
+	}
+	wg.Wait()
+
+	if firstErr == nil && ctx.Err() != nil {
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil {
+		return s.abortMultipart(ctx, key, uploadID, firstErr)
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return aws.ToInt32(parts[i].PartNumber) < aws.ToInt32(parts[j].PartNumber)
+	})
+	_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(key),
+		UploadId:        uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return s.abortMultipart(ctx, key, uploadID, fmt.Errorf("couldn't complete multipart upload: %w", err))
+	}
+	return nil
+}
+
+func (s *S3Store) abortMultipart(ctx context.Context, key string, uploadID *string, cause error) error {
+	// the request context may already be cancelled, the abort still has to go out
+	abortCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	_, err := s.client.AbortMultipartUpload(abortCtx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+	})
+	if err != nil {
+		return fmt.Errorf("multipart upload of %s failed: %w (abort also failed: %v)", key, cause, err)
+	}
+	return fmt.Errorf("multipart upload of %s failed: %w", key, cause)
+}
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// fakeS3 answers the multipart upload API for a single bucket and keeps
+// what it was sent.
+type fakeS3 struct {
+	mu      sync.Mutex
+	parts   map[int][]byte
+	objects map[string][]byte
+	calls   []string
+	// failPart makes UploadPart of that part number fail.
+	failPart int
+	// failComplete makes CompleteMultipartUpload fail.
+	failComplete bool
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *S3Store) {
+	fake := &fakeS3{parts: map[int][]byte{}, objects: map[string][]byte{}}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	client := s3.New(s3.Options{
+		Region:                     "us-east-1",
+		BaseEndpoint:               aws.String(srv.URL),
+		UsePathStyle:               true,
+		Credentials:                credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		Retryer:                    aws.NopRetryer{},
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+		ResponseChecksumValidation: aws.ResponseChecksumValidationWhenRequired,
+	})
+	store := NewS3Store(client, "bucket", "us-east-1", MultipartConfig{PartSize: MinPartSize, Concurrency: 2})
+	return fake, store
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.calls = append(f.calls, "create")
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>%s</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`, key)
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		f.calls = append(f.calls, "part")
+		if number == f.failPart {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `<Error><Code>InternalError</Code><Message>part failed</Message></Error>`)
+			return
+		}
+		f.parts[number] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, number))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		f.calls = append(f.calls, "complete")
+		if f.failComplete {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `<Error><Code>InternalError</Code><Message>complete failed</Message></Error>`)
+			return
+		}
+		var req struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var object []byte
+		for i, part := range req.Parts {
+			if part.PartNumber != i+1 || part.ETag != fmt.Sprintf(`"etag-%d"`, part.PartNumber) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `<Error><Code>InvalidPartOrder</Code><Message>bad part list</Message></Error>`)
+				return
+			}
+			object = append(object, f.parts[part.PartNumber]...)
+		}
+		f.objects[key] = object
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>%s</Key><ETag>"done"</ETag></CompleteMultipartUploadResult>`, key)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		f.calls = append(f.calls, "abort")
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.calls = append(f.calls, "put")
+		f.objects[key] = body
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeS3) called(call string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.calls {
+		if c == call {
+			n++
+		}
+	}
+	return n
+}
+
+// testData is a bit over two and a half parts long, so the last part is short.
+func testData() []byte {
+	data := make([]byte, 2*MinPartSize+MinPartSize/2)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func TestS3PutMultipart(t *testing.T) {
+	fake, store := newFakeS3(t)
+	data := testData()
+
+	err := store.Put(context.Background(), "videos/a.mp4", bytes.NewReader(data), "video/mp4")
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	if got := fake.called("part"); got != 3 {
+		t.Errorf("uploaded %d parts, want 3", got)
+	}
+	if fake.called("complete") != 1 || fake.called("abort") != 0 {
+		t.Errorf("calls = %v, want one complete and no abort", fake.calls)
+	}
+	if !bytes.Equal(fake.objects["videos/a.mp4"], data) {
+		t.Errorf("stored object doesn't match the uploaded data")
+	}
+}
+
+func TestS3PutSmallObjectSkipsMultipart(t *testing.T) {
+	fake, store := newFakeS3(t)
+
+	err := store.Put(context.Background(), "thumbnails/a.jpg", strings.NewReader("jpeg"), "image/jpeg")
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if fake.called("create") != 0 || string(fake.objects["thumbnails/a.jpg"]) != "jpeg" {
+		t.Errorf("calls = %v, want a single put", fake.calls)
+	}
+}
+
+func TestS3PutMultipartAbortsOnPartFailure(t *testing.T) {
+	fake, store := newFakeS3(t)
+	fake.failPart = 2
+
+	err := store.Put(context.Background(), "videos/a.mp4", bytes.NewReader(testData()), "video/mp4")
+	if err == nil || !strings.Contains(err.Error(), "part 2") {
+		t.Fatalf("Put error = %v, want a part 2 failure", err)
+	}
+	if fake.called("abort") != 1 {
+		t.Errorf("calls = %v, want an abort", fake.calls)
+	}
+	if fake.called("complete") != 0 {
+		t.Errorf("calls = %v, want no complete", fake.calls)
+	}
+	if _, ok := fake.objects["videos/a.mp4"]; ok {
+		t.Errorf("object was stored despite the failed part")
+	}
+}
+
+func TestS3PutMultipartAbortsOnCompleteFailure(t *testing.T) {
+	fake, store := newFakeS3(t)
+	fake.failComplete = true
+
+	err := store.Put(context.Background(), "videos/a.mp4", bytes.NewReader(testData()), "video/mp4")
+	if err == nil {
+		t.Fatal("Put succeeded, want an error")
+	}
+	if fake.called("abort") != 1 {
+		t.Errorf("calls = %v, want an abort", fake.calls)
+	}
+}
+
+func TestS3PutMultipartAbortsOnCancel(t *testing.T) {
+	fake, store := newFakeS3(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	//cancelling while the second part is read from the body
+	body := io.MultiReader(bytes.NewReader(testData()[:MinPartSize]), readerFunc(func(p []byte) (int, error) {
+		cancel()
+		return 0, context.Canceled
+	}))
+	err := store.Put(ctx, "videos/a.mp4", body, "video/mp4")
+	if err == nil {
+		t.Fatal("Put succeeded, want an error")
+	}
+	if fake.called("abort") != 1 || fake.called("complete") != 0 {
+		t.Errorf("calls = %v, want an abort and no complete", fake.calls)
+	}
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
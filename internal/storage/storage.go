@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when the requested key does not exist in the store.
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// ObjectStore is the storage backend used for uploaded media. Keys are
+// slash-separated paths relative to the root of the store.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	// GetRange reads length bytes of the object starting at offset, fewer
+	// if the object ends before that.
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	Head(ctx context.Context, key string) (ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	URL(key string) string
+}
+
+// ReaderAt reads an object of the given size with ranged reads, so looking
+// at parts of it doesn't download the whole object.
+func ReaderAt(ctx context.Context, store ObjectStore, key string, size int64) io.ReaderAt {
+	return &rangeReader{ctx: ctx, store: store, key: key, size: size}
+}
+
+type rangeReader struct {
+	ctx   context.Context
+	store ObjectStore
+	key   string
+	size  int64
+}
+
+func (r *rangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	body, err := r.store.GetRange(r.ctx, r.key, off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Presigner is implemented by stores that keep objects private and hand out
+// time-limited URLs to read them.
+type Presigner interface {
+	PresignGet(ctx context.Context, key string, expires time.Duration) (string, error)
+}
+
+// PostPolicy restricts what a browser may upload with a presigned POST.
+type PostPolicy struct {
+	KeyPrefix   string
+	ContentType string
+	MinSize     int64
+	MaxSize     int64
+	Expires     time.Duration
+}
+
+// PresignedPost is a form target: the file has to be posted to URL as
+// multipart form data, after all of Fields.
+type PresignedPost struct {
+	URL    string            `json:"url"`
+	Fields map[string]string `json:"fields"`
+}
+
+// PostPresigner is implemented by stores that accept uploads straight from
+// the browser.
+type PostPresigner interface {
+	PresignPost(ctx context.Context, key string, policy PostPolicy) (PresignedPost, error)
+}
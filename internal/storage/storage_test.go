@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testStores returns a fresh instance of every backend that runs without
+// external services.
+func testStores(t *testing.T) map[string]ObjectStore {
+	return map[string]ObjectStore{
+		"memory": NewMemoryStore("http://localhost/"),
+		"local":  NewLocalStore(t.TempDir(), "http://localhost/"),
+	}
+}
+
+func readObject(t *testing.T, store ObjectStore, key string) string {
+	t.Helper()
+	body, _, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestObjectStore(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := store.Put(ctx, "videos/a.mp4", strings.NewReader("first"), "video/mp4"); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			if got := readObject(t, store, "videos/a.mp4"); got != "first" {
+				t.Errorf("Get = %q, want %q", got, "first")
+			}
+			info, err := store.Head(ctx, "videos/a.mp4")
+			if err != nil {
+				t.Fatalf("Head: %v", err)
+			}
+			if info.Key != "videos/a.mp4" || info.Size != 5 {
+				t.Errorf("Head = %+v", info)
+			}
+
+			//overwriting replaces the content and the etag
+			if err := store.Put(ctx, "videos/a.mp4", strings.NewReader("second!"), "video/mp4"); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			if got := readObject(t, store, "videos/a.mp4"); got != "second!" {
+				t.Errorf("Get after overwrite = %q, want %q", got, "second!")
+			}
+			overwritten, err := store.Head(ctx, "videos/a.mp4")
+			if err != nil {
+				t.Fatalf("Head: %v", err)
+			}
+			if overwritten.Size != 7 || overwritten.ETag == info.ETag {
+				t.Errorf("Head after overwrite = %+v, was %+v", overwritten, info)
+			}
+
+			if err := store.Put(ctx, "videos/b.mp4", strings.NewReader("other"), "video/mp4"); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			objects, err := store.List(ctx, "videos/")
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			keys := []string{}
+			for _, object := range objects {
+				keys = append(keys, object.Key)
+			}
+			slices.Sort(keys)
+			if !slices.Equal(keys, []string{"videos/a.mp4", "videos/b.mp4"}) {
+				t.Errorf("List = %v", keys)
+			}
+
+			if err := store.Delete(ctx, "videos/a.mp4"); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			//deleting is idempotent
+			if err := store.Delete(ctx, "videos/a.mp4"); err != nil {
+				t.Errorf("deleting again: %v", err)
+			}
+			if got := readObject(t, store, "videos/b.mp4"); got != "other" {
+				t.Errorf("Get of the other object = %q", got)
+			}
+
+			//deleted objects, missing ones and "directories" are all not found
+			for _, key := range []string{"videos/a.mp4", "videos/missing.mp4", "videos"} {
+				if _, _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+					t.Errorf("Get(%q) = %v, want ErrNotFound", key, err)
+				}
+				if _, err := store.Head(ctx, key); !errors.Is(err, ErrNotFound) {
+					t.Errorf("Head(%q) = %v, want ErrNotFound", key, err)
+				}
+				if _, err := store.GetRange(ctx, key, 0, 4); !errors.Is(err, ErrNotFound) {
+					t.Errorf("GetRange(%q) = %v, want ErrNotFound", key, err)
+				}
+			}
+		})
+	}
+}
+
+func TestReaderAt(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			data := "0123456789"
+			if err := store.Put(ctx, "a/object", strings.NewReader(data), "text/plain"); err != nil {
+				t.Fatal(err)
+			}
+			r := ReaderAt(ctx, store, "a/object", int64(len(data)))
+
+			tests := []struct {
+				off     int64
+				n       int
+				want    string
+				wantErr error
+			}{
+				{0, 4, "0123", nil},
+				{6, 4, "6789", nil},
+				{8, 4, "89", io.EOF},
+				{10, 4, "", io.EOF},
+			}
+			for _, tt := range tests {
+				p := make([]byte, tt.n)
+				n, err := r.ReadAt(p, tt.off)
+				if string(p[:n]) != tt.want || err != tt.wantErr {
+					t.Errorf("ReadAt(%d bytes at %d) = %q, %v, want %q, %v", tt.n, tt.off, p[:n], err, tt.want, tt.wantErr)
+				}
+			}
+
+			_, err := ReaderAt(ctx, store, "a/missing", 10).ReadAt(make([]byte, 4), 0)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("reading a missing object = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+const (
+	MediaTypeMP4  = "video/mp4"
+	MediaTypePNG  = "image/png"
+	MediaTypeJPEG = "image/jpeg"
+)
+
+// Error is a rejected upload. It is meant to be sent to the client as is.
+type Error struct {
+	Status       int    `json:"-"`
+	Code         string `json:"code"`
+	Message      string `json:"error"`
+	DetectedType string `json:"detected_type,omitempty"`
+	DeclaredType string `json:"declared_type,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Rule describes what an upload endpoint accepts. Zero limits are not enforced.
+type Rule struct {
+	MediaTypes []string
+	MaxSize    int64
+	MinWidth   int
+	MinHeight  int
+	MaxWidth   int
+	MaxHeight  int
+}
+
+// mp4Brands are the ftyp brands of the ISO base media and MP4 families.
+// QuickTime ("qt  ") and 3GPP ("3gp4", "3g2a", ...) files share the box
+// structure but aren't accepted as MP4.
+var mp4Brands = []string{
+	"isom", "iso2", "iso3", "iso4", "iso5", "iso6", "iso7", "iso8", "iso9",
+	"mp41", "mp42", "avc1", "dash", "M4V ", "mmp4",
+}
+
+// Sniff detects the media type of a file from its first bytes. It only
+// knows the types uploads are accepted as and returns "" for anything else.
+func Sniff(header []byte) string {
+	switch {
+	case len(header) >= 12 && string(header[4:8]) == "ftyp":
+		if !isMP4Brand(header) {
+			return ""
+		}
+		return MediaTypeMP4
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return MediaTypePNG
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return MediaTypeJPEG
+	default:
+		return ""
+	}
+}
+
+// isMP4Brand checks the ftyp box at the start of header: the major brand
+// can't be QuickTime or 3GPP, and it or one of the compatible brands has to
+// be an MP4 brand.
+func isMP4Brand(header []byte) bool {
+	major := string(header[8:12])
+	if major == "qt  " || strings.HasPrefix(major, "3g") {
+		return false
+	}
+	if slices.Contains(mp4Brands, major) {
+		return true
+	}
+	//the compatible brands follow the major brand and minor version
+	end := min(int64(binary.BigEndian.Uint32(header[0:4])), int64(len(header)))
+	for i := int64(16); i+4 <= end; i += 4 {
+		if slices.Contains(mp4Brands, string(header[i:i+4])) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks an uploaded file against the rule: its content has to be
+// one of the accepted types, match the declared Content-Type (if any),
+// parse as that type and fit the size and dimension limits. It returns
+// the detected media type.
+func (rule Rule) Validate(r io.ReaderAt, size int64, declared string) (string, error) {
+	if size == 0 {
+		return "", &Error{Status: http.StatusUnprocessableEntity, Code: "empty_file", Message: "File is empty"}
+	}
+	if rule.MaxSize > 0 && size > rule.MaxSize {
+		return "", &Error{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    "file_too_large",
+			Message: fmt.Sprintf("File is %d bytes, the limit is %d", size, rule.MaxSize),
+		}
+	}
+
+	header := make([]byte, 512)
+	n, err := r.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	detected := Sniff(header[:n])
+	if detected == "" || !slices.Contains(rule.MediaTypes, detected) {
+		return "", &Error{
+			Status:       http.StatusUnsupportedMediaType,
+			Code:         "unsupported_type",
+			Message:      "File content isn't one of the accepted types",
+			DetectedType: detected,
+			DeclaredType: declared,
+		}
+	}
+	if declared != "" {
+		declaredType, _, err := mime.ParseMediaType(declared)
+		if err != nil || declaredType != detected {
+			return "", &Error{
+				Status:       http.StatusUnsupportedMediaType,
+				Code:         "type_mismatch",
+				Message:      "File content doesn't match its declared Content-Type",
+				DetectedType: detected,
+				DeclaredType: declared,
+			}
+		}
+	}
+
+	switch detected {
+	case MediaTypeMP4:
+		err = validateMP4(r, size)
+	default:
+		err = rule.validateImage(r, size)
+	}
+	if err != nil {
+		return "", err
+	}
+	return detected, nil
+}
+
+// CheckDimensions enforces the rule's dimension limits, for types whose
+// dimensions are only known after further processing.
+func (rule Rule) CheckDimensions(width, height int) error {
+	if (rule.MinWidth > 0 && width < rule.MinWidth) ||
+		(rule.MinHeight > 0 && height < rule.MinHeight) ||
+		(rule.MaxWidth > 0 && width > rule.MaxWidth) ||
+		(rule.MaxHeight > 0 && height > rule.MaxHeight) {
+		return &Error{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    "dimensions_out_of_range",
+			Message: fmt.Sprintf("Dimensions %dx%d are outside the accepted range", width, height),
+		}
+	}
+	return nil
+}
+
+func validateMP4(r io.ReaderAt, size int64) error {
+	boxes, err := media.TopLevelBoxes(r, size)
+	if err != nil {
+		return &Error{Status: http.StatusUnprocessableEntity, Code: "invalid_container", Message: err.Error()}
+	}
+	types := []string{}
+	for _, box := range boxes {
+		types = append(types, box.Type)
+	}
+	if len(types) == 0 || types[0] != "ftyp" || !slices.Contains(types, "moov") || !slices.Contains(types, "mdat") {
+		return &Error{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    "invalid_container",
+			Message: "MP4 must start with an ftyp box and contain moov and mdat boxes",
+		}
+	}
+	return nil
+}
+
+func (rule Rule) validateImage(r io.ReaderAt, size int64) error {
+	config, _, err := image.DecodeConfig(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return &Error{Status: http.StatusUnprocessableEntity, Code: "invalid_image", Message: fmt.Sprintf("Couldn't read image: %v", err)}
+	}
+	return rule.CheckDimensions(config.Width, config.Height)
+}
@@ -0,0 +1,136 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"testing"
+)
+
+// box encodes an MP4 box with a 32-bit size.
+func box(typ string, payload []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	return append(append(b, typ...), payload...)
+}
+
+// ftyp encodes an ftyp box with the given major and compatible brands.
+func ftyp(major string, compatible ...string) []byte {
+	payload := append([]byte(major), 0, 0, 0, 0)
+	for _, brand := range compatible {
+		payload = append(payload, brand...)
+	}
+	return box("ftyp", payload)
+}
+
+func mp4(ftypBox []byte) []byte {
+	data := append([]byte{}, ftypBox...)
+	data = append(data, box("moov", make([]byte, 32))...)
+	return append(data, box("mdat", make([]byte, 64))...)
+}
+
+func pngImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"mp4", ftyp("mp42", "mp42", "isom"), MediaTypeMP4},
+		{"isom", ftyp("isom", "isom", "iso2", "avc1", "mp41"), MediaTypeMP4},
+		{"mp4 brand only compatible", ftyp("XAVC", "XAVC", "mp42", "iso2"), MediaTypeMP4},
+		{"quicktime", ftyp("qt  ", "qt  "), ""},
+		{"quicktime claiming isom", ftyp("qt  ", "qt  ", "isom"), ""},
+		{"3gp", ftyp("3gp4", "isom", "3gp4"), ""},
+		{"3g2", ftyp("3g2a", "3g2a"), ""},
+		{"unknown brand", ftyp("abcd", "abcd"), ""},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00"), MediaTypePNG},
+		{"jpeg", []byte{0xFF, 0xD8, 0xFF, 0xE0}, MediaTypeJPEG},
+		{"text", []byte("hello, world"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sniff(tt.header); got != tt.want {
+				t.Errorf("Sniff = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	videoRule := Rule{MediaTypes: []string{MediaTypeMP4}, MaxSize: 1 << 20}
+	imageRule := Rule{MediaTypes: []string{MediaTypePNG, MediaTypeJPEG}, MaxWidth: 100, MaxHeight: 100}
+	valid := mp4(ftyp("mp42", "mp42", "isom"))
+	truncated := append(ftyp("mp42", "mp42"), box("moov", make([]byte, 32))[:20]...)
+
+	tests := []struct {
+		name     string
+		rule     Rule
+		data     []byte
+		declared string
+		wantCode string
+	}{
+		{"valid mp4", videoRule, valid, "video/mp4", ""},
+		{"no declared type", videoRule, valid, "", ""},
+		{"mov", videoRule, mp4(ftyp("qt  ", "qt  ")), "video/mp4", "unsupported_type"},
+		{"3gp", videoRule, mp4(ftyp("3gp4", "isom", "3gp4")), "video/mp4", "unsupported_type"},
+		{"declared as another type", videoRule, valid, "video/quicktime", "type_mismatch"},
+		{"truncated box", videoRule, truncated, "video/mp4", "invalid_container"},
+		{"missing mdat", videoRule, append(ftyp("mp42", "mp42"), box("moov", nil)...), "video/mp4", "invalid_container"},
+		{"too large", Rule{MediaTypes: []string{MediaTypeMP4}, MaxSize: 64}, valid, "video/mp4", "file_too_large"},
+		{"empty", videoRule, nil, "video/mp4", "empty_file"},
+		{"image within limits", imageRule, pngImage(t, 100, 50), "image/png", ""},
+		{"oversized image", imageRule, pngImage(t, 200, 50), "image/png", "dimensions_out_of_range"},
+		{"image where video is expected", videoRule, pngImage(t, 10, 10), "image/png", "unsupported_type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.rule.Validate(bytes.NewReader(tt.data), int64(len(tt.data)), tt.declared)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("Validate = %v", err)
+				}
+				return
+			}
+			var validationErr *Error
+			if !errors.As(err, &validationErr) || validationErr.Code != tt.wantCode {
+				t.Fatalf("Validate = %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestCheckDimensions(t *testing.T) {
+	rule := Rule{MinWidth: 320, MinHeight: 240, MaxWidth: 3840, MaxHeight: 2160}
+	tests := []struct {
+		width, height int
+		ok            bool
+	}{
+		{1920, 1080, true},
+		{320, 240, true},
+		{3840, 2160, true},
+		{319, 240, false},
+		{7680, 4320, false},
+		{1080, 4000, false},
+	}
+	for _, tt := range tests {
+		err := rule.CheckDimensions(tt.width, tt.height)
+		var validationErr *Error
+		if tt.ok && err != nil {
+			t.Errorf("CheckDimensions(%d, %d) = %v", tt.width, tt.height, err)
+		}
+		if !tt.ok && (!errors.As(err, &validationErr) || validationErr.Status != http.StatusUnprocessableEntity) {
+			t.Errorf("CheckDimensions(%d, %d) = %v, want a 422", tt.width, tt.height, err)
+		}
+	}
+}
@@ -2,17 +2,24 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/cdn"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
-	"github.com/google/uuid"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/jobs"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/progress"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
@@ -24,30 +31,51 @@ type apiConfig struct {
 	s3Bucket         string
 	s3Region         string
 	s3CfDistribution string
-	s3Client         *s3.Client
+	store            storage.ObjectStore
+	storageBucket    string
+	presignExpiry    time.Duration
+	cdn              *cdn.URLBuilder
+	uploadsRoot      string
+	thumbnailOffset  time.Duration
+	thumbnailWebP    bool
+	uploadLocks      *sync.Map
+	progress         *progress.Broker
+	trashRetention   time.Duration
+	uploadExpiry     time.Duration
 	port             string
 }
 
-type thumbnail struct {
-	data      []byte
-	mediaType string
-}
-
-var videoThumbnails = map[uuid.UUID]thumbnail{}
-
 func main() {
 	godotenv.Load(".env")
 
-	pathToDB := os.Getenv("DB_PATH")
+	//DB_URL picks the database by scheme, DB_PATH is the older sqlite-only setting
+	pathToDB := os.Getenv("DB_URL")
+	if pathToDB == "" {
+		pathToDB = os.Getenv("DB_PATH")
+	}
 	if pathToDB == "" {
 		log.Fatal("DB_URL must be set")
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(pathToDB, os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
 	db, err := database.NewClient(pathToDB)
 	if err != nil {
 		log.Fatalf("Couldn't connect to database: %v", err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "reindex" {
+		if err := runReindex(db, os.Args[2:]); err != nil {
+			log.Fatalf("Reindexing failed: %v", err)
+		}
+		return
+	}
+
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
 		log.Fatal("JWT_SECRET environment variable is not set")
@@ -68,34 +96,74 @@ func main() {
 		log.Fatal("ASSETS_ROOT environment variable is not set")
 	}
 
+	storageBackend := os.Getenv("STORAGE_BACKEND")
+	if storageBackend == "" {
+		storageBackend = "s3"
+	}
+
 	s3Bucket := os.Getenv("S3_BUCKET")
-	if s3Bucket == "" {
+	if s3Bucket == "" && storageBackend == "s3" {
 		log.Fatal("S3_BUCKET environment variable is not set")
 	}
 
 	s3Region := os.Getenv("S3_REGION")
-	if s3Region == "" {
+	if s3Region == "" && storageBackend == "s3" {
 		log.Fatal("S3_REGION environment variable is not set")
 	}
 
 	s3CfDistribution := os.Getenv("S3_CF_DISTRO")
-	if s3CfDistribution == "" {
-		log.Fatal("S3_CF_DISTRO environment variable is not set")
-	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		log.Fatal("PORT environment variable is not set")
 	}
 
-	//using config.LoadDefaultConfig to auto load the default aws sdk config
-	awsConfig, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(s3Region))
-	if err != nil {
-		log.Fatal("S3 Region config not set")
+	uploadsRoot := os.Getenv("UPLOADS_ROOT")
+	if uploadsRoot == "" {
+		uploadsRoot = filepath.Join(os.TempDir(), "tubely-uploads")
+	}
+
+	//offset of the frame used for generated thumbnails, "best" (or unset) picks one automatically
+	var thumbnailOffset time.Duration
+	if offset := os.Getenv("THUMBNAIL_OFFSET"); offset != "" && offset != "best" {
+		thumbnailOffset, err = time.ParseDuration(offset)
+		if err != nil {
+			log.Fatalf("Invalid THUMBNAIL_OFFSET: %v", err)
+		}
 	}
 
-	//creating a client using newfromconfig
-	newS3Client := s3.NewFromConfig(awsConfig)
+	presignExpiry := 15 * time.Minute
+	if expiry := os.Getenv("S3_PRESIGN_EXPIRY"); expiry != "" {
+		presignExpiry, err = time.ParseDuration(expiry)
+		if err != nil {
+			log.Fatalf("Invalid S3_PRESIGN_EXPIRY: %v", err)
+		}
+	}
+
+	//picking the object store used for videos and thumbnails
+	var store storage.ObjectStore
+	storageBucket := storageBackend
+	switch storageBackend {
+	case "s3":
+		//using config.LoadDefaultConfig to auto load the default aws sdk config
+		awsConfig, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(s3Region))
+		if err != nil {
+			log.Fatal("S3 Region config not set")
+		}
+		//creating a client using newfromconfig
+		multipart := storage.MultipartConfig{
+			PartSize:    envInt("S3_PART_SIZE_MB", 8) << 20,
+			Concurrency: int(envInt("S3_UPLOAD_CONCURRENCY", 4)),
+		}
+		store = storage.NewS3Store(s3.NewFromConfig(awsConfig), s3Bucket, s3Region, multipart)
+		storageBucket = s3Bucket
+	case "local":
+		store = storage.NewLocalStore(assetsRoot, fmt.Sprintf("http://localhost:%s/assets", port))
+	case "memory":
+		store = storage.NewMemoryStore(fmt.Sprintf("http://localhost:%s/objects", port))
+	default:
+		log.Fatalf("Unknown STORAGE_BACKEND %q, expected s3, local or memory", storageBackend)
+	}
 
 	cfg := apiConfig{
 		db:               db,
@@ -106,8 +174,17 @@ func main() {
 		s3Bucket:         s3Bucket,
 		s3Region:         s3Region,
 		s3CfDistribution: s3CfDistribution,
+		store:            store,
+		storageBucket:    storageBucket,
+		presignExpiry:    presignExpiry,
+		uploadsRoot:      uploadsRoot,
+		thumbnailOffset:  thumbnailOffset,
+		thumbnailWebP:    os.Getenv("THUMBNAIL_WEBP") == "true",
+		uploadLocks:      &sync.Map{},
+		progress:         progress.NewBroker(),
+		trashRetention:   time.Duration(envInt("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour,
+		uploadExpiry:     time.Duration(envInt("UPLOAD_SESSION_EXPIRY_HOURS", 24)) * time.Hour,
 		port:             port,
-		s3Client:         newS3Client,
 	}
 
 	err = cfg.ensureAssetsDir()
@@ -115,6 +192,57 @@ func main() {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
 
+	err = os.MkdirAll(uploadsRoot, 0700)
+	if err != nil {
+		log.Fatalf("Couldn't create uploads directory: %v", err)
+	}
+
+	//serving media through the cloudfront distribution when one is configured
+	if s3CfDistribution != "" {
+		var signer *cdn.Signer
+		if keyPairID := os.Getenv("CF_KEY_PAIR_ID"); keyPairID != "" {
+			keyPEM, err := os.ReadFile(os.Getenv("CF_PRIVATE_KEY_PATH"))
+			if err != nil {
+				log.Fatalf("Couldn't read CF_PRIVATE_KEY_PATH: %v", err)
+			}
+			privateKey, err := cdn.ParsePrivateKey(keyPEM)
+			if err != nil {
+				log.Fatalf("Couldn't load CloudFront private key: %v", err)
+			}
+			signer = cdn.NewSigner(keyPairID, privateKey)
+		}
+		cfg.cdn, err = cdn.NewURLBuilder(s3CfDistribution, signer, presignExpiry)
+		if err != nil {
+			log.Fatalf("Invalid S3_CF_DISTRO: %v", err)
+		}
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "gc" {
+		if err := runGC(&cfg, os.Args[2:]); err != nil {
+			log.Fatalf("Garbage collection failed: %v", err)
+		}
+		return
+	}
+
+	//nothing is processing videos before the server starts
+	err = db.FailInterruptedVideos(context.Background())
+	if err != nil {
+		log.Fatalf("Couldn't reset interrupted videos: %v", err)
+	}
+
+	//removing replaced and deleted media from storage
+	go cfg.runStorageDeletions(context.Background())
+	go cfg.runTrashPurge(context.Background())
+	go cfg.runUploadSessionExpiry(context.Background())
+
+	//running background jobs like hls transcoding
+	runner := jobs.NewRunner(db, jobs.Config{
+		Workers: int(envInt("JOB_WORKERS", int64(jobs.DefaultConfig.Workers))),
+	})
+	runner.Register(jobTypeTranscodeHLS, cfg.handleTranscodeHLSJob)
+	runner.Register(jobTypeProcessDirectUpload, cfg.handleProcessDirectUploadJob)
+	go runner.Run(context.Background())
+
 	mux := http.NewServeMux()
 	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
 	mux.Handle("/app/", appHandler)
@@ -122,6 +250,10 @@ func main() {
 	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
 	mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
 
+	if storageBackend == "memory" {
+		mux.Handle("GET /objects/", http.StripPrefix("/objects/", cfg.handlerObjectGet()))
+	}
+
 	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
 	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
@@ -131,11 +263,31 @@ func main() {
 	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
 	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
 	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/presign", cfg.handlerUploadVideoPresign)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/complete", cfg.handlerUploadVideoComplete)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/sessions", cfg.handlerUploadSessionCreate)
+	mux.HandleFunc("HEAD /api/uploads/{uploadID}", cfg.handlerUploadSessionHead)
+	mux.HandleFunc("PATCH /api/uploads/{uploadID}", cfg.handlerUploadSessionPatch)
+	mux.HandleFunc("POST /api/uploads/{uploadID}/complete", cfg.handlerUploadSessionComplete)
+	mux.HandleFunc("DELETE /api/uploads/{uploadID}", cfg.handlerUploadSessionDelete)
 	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
 	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
+	mux.HandleFunc("GET /api/videos/trash", cfg.handlerVideosTrashRetrieve)
+	mux.HandleFunc("POST /api/videos/{videoID}/restore", cfg.handlerVideoRestore)
+	mux.HandleFunc("GET /api/videos/{videoID}/events", cfg.handlerVideoEvents)
+	mux.HandleFunc("POST /api/videos/{videoID}/events/token", cfg.handlerVideoEventsToken)
+	mux.HandleFunc("GET /api/videos/{videoID}/hls/{file...}", cfg.handlerHLSPlaylist)
 	mux.HandleFunc("GET /api/thumbnails/{videoID}", cfg.handlerThumbnailGet)
+	mux.HandleFunc("POST /api/videos/{videoID}/thumbnail/regenerate", cfg.handlerThumbnailRegenerate)
+	mux.HandleFunc("PATCH /api/videos/{videoID}", cfg.handlerVideoMetaUpdate)
 	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
 
+	mux.HandleFunc("GET /api/search", cfg.handlerSearch)
+
+	mux.HandleFunc("GET /api/jobs", cfg.handlerJobsList)
+	mux.HandleFunc("GET /api/jobs/{jobID}", cfg.handlerJobGet)
+	mux.HandleFunc("POST /api/jobs/{jobID}/retry", cfg.handlerJobRetry)
+
 	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
 
 	srv := &http.Server{
@@ -146,3 +298,16 @@ func main() {
 	log.Printf("Serving on: http://localhost:%s/app/\n", port)
 	log.Fatal(srv.ListenAndServe())
 }
+
+// envInt reads an optional integer environment variable.
+func envInt(name string, fallback int64) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", name, err)
+	}
+	return n
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/progress"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// newTestConfig returns a config with a fresh SQLite database, an in-memory
+// store and a user to own test videos.
+func newTestConfig(t *testing.T) (*apiConfig, *database.User) {
+	t.Helper()
+	db, err := database.NewClient("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := db.CreateUser(context.Background(), database.CreateUserParams{Email: "test@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &apiConfig{
+		db:          db,
+		jwtSecret:   "test-secret",
+		store:       storage.NewMemoryStore("http://localhost:8091/media/"),
+		uploadsRoot: t.TempDir(),
+		uploadLocks: &sync.Map{},
+		progress:    progress.NewBroker(),
+	}, user
+}
+
+// authorize adds an access token for the user to the request.
+func authorize(t *testing.T, cfg *apiConfig, r *http.Request, user *database.User) {
+	t.Helper()
+	token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+}
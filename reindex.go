@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// runReindex implements the reindex command: it rebuilds the video search
+// index from the videos table. The index is kept in sync on every write, so
+// this is only needed if it was changed by hand or got corrupted.
+func runReindex(db database.Client, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("reindex takes no arguments")
+	}
+	if err := db.RebuildSearchIndex(context.Background()); err != nil {
+		return err
+	}
+	fmt.Println("search index rebuilt")
+	return nil
+}
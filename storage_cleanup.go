@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// Replacing or deleting a video's media queues the old references in the
+// storage_deletions outbox as part of the database update. The relay below
+// removes them from storage afterwards and retries until that works.
+
+const (
+	storageDeletionInterval  = 10 * time.Second
+	storageDeletionBatchSize = 50
+	storageDeletionMaxDelay  = time.Hour
+)
+
+func (cfg *apiConfig) runStorageDeletions(ctx context.Context) {
+	ticker := time.NewTicker(storageDeletionInterval)
+	defer ticker.Stop()
+	for {
+		cfg.processStorageDeletions(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// discardMedia queues media stored for a change that wasn't saved. It
+// outlives the request, which is often what failed.
+func (cfg *apiConfig) discardMedia(ctx context.Context, refs []database.MediaRef) {
+	if len(refs) == 0 {
+		return
+	}
+	err := cfg.db.QueueStorageDeletions(context.WithoutCancel(ctx), refs)
+	if err != nil {
+		log.Printf("couldn't queue deletion of %d unsaved objects: %v", len(refs), err)
+	}
+}
+
+// addedMedia lists the media after references that before doesn't.
+func addedMedia(before, after database.Video) []database.MediaRef {
+	existing := map[database.MediaRef]bool{}
+	for _, ref := range before.MediaRefs() {
+		existing[ref] = true
+	}
+	added := []database.MediaRef{}
+	for _, ref := range after.MediaRefs() {
+		if !existing[ref] {
+			added = append(added, ref)
+		}
+	}
+	return added
+}
+
+func (cfg *apiConfig) processStorageDeletions(ctx context.Context) {
+	deletions, err := cfg.db.GetDueStorageDeletions(ctx, storageDeletionBatchSize)
+	if err != nil {
+		log.Printf("couldn't get pending storage deletions: %v", err)
+		return
+	}
+
+	for _, deletion := range deletions {
+		err := cfg.deleteMedia(ctx, deletion.MediaRef)
+		if err == nil {
+			err = cfg.db.CompleteStorageDeletion(ctx, deletion.ID)
+			if err != nil {
+				log.Printf("couldn't complete storage deletion %s: %v", deletion.ID, err)
+			}
+			continue
+		}
+
+		delay := min(time.Minute<<deletion.Attempts, storageDeletionMaxDelay)
+		log.Printf("couldn't delete %s, retrying in %s: %v", deletion.Ref, delay, err)
+		err = cfg.db.RetryStorageDeletion(ctx, deletion.ID, err.Error(), time.Now().Add(delay))
+		if err != nil {
+			log.Printf("couldn't schedule retry of storage deletion %s: %v", deletion.ID, err)
+		}
+	}
+}
+
+// deleteMedia removes referenced media from wherever it is stored. Media
+// that is already gone or lives outside of our storage counts as deleted.
+func (cfg *apiConfig) deleteMedia(ctx context.Context, ref database.MediaRef) error {
+	key, ok := cfg.mediaKey(ref.Ref)
+	if !ok {
+		assetPath, ok := cfg.legacyAssetPath(ref.Ref)
+		if !ok {
+			return nil
+		}
+		err := os.Remove(assetPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	keys := []string{key}
+	if ref.Kind == database.MediaHLS {
+		//the playlists and segments all live next to the master playlist
+		objects, err := cfg.store.List(ctx, path.Dir(key)+"/")
+		if err != nil {
+			return fmt.Errorf("couldn't list hls files: %w", err)
+		}
+		keys = keys[:0]
+		for _, object := range objects {
+			keys = append(keys, object.Key)
+		}
+	}
+
+	for _, key := range keys {
+		err := cfg.store.Delete(ctx, key)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// legacyAssetPath returns the file in assetsRoot behind a reference from
+// before media moved to the object store, when thumbnails were saved
+// locally and stored as http://localhost:<port>//assets/<name>.
+func (cfg *apiConfig) legacyAssetPath(ref string) (string, bool) {
+	u, err := url.Parse(ref)
+	if err != nil || u.Hostname() != "localhost" {
+		return "", false
+	}
+	//the old handler joined the port and the assets root with a doubled slash
+	name, ok := strings.CutPrefix(strings.TrimLeft(path.Clean(u.Path), "/"), "assets/")
+	if !ok || !filepath.IsLocal(name) {
+		return "", false
+	}
+	return filepath.Join(cfg.assetsRoot, filepath.FromSlash(name)), true
+}
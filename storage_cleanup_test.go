@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+func TestLegacyAssetPath(t *testing.T) {
+	cfg := &apiConfig{assetsRoot: "/srv/assets"}
+
+	tests := []struct {
+		ref  string
+		want string
+		ok   bool
+	}{
+		//the format the original thumbnail handler wrote
+		{"http://localhost:8091//assets/abc.png", "/srv/assets/abc.png", true},
+		{"http://localhost:8091/assets/abc.png", "/srv/assets/abc.png", true},
+		{"http://localhost:8091//assets/../secret", "", false},
+		{"http://localhost:8091//other/abc.png", "", false},
+		{"https://example.com//assets/abc.png", "", false},
+		{"bucket,thumbnails/abc.png", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := cfg.legacyAssetPath(tt.ref)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("legacyAssetPath(%q) = %q, %v, want %q, %v", tt.ref, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDeleteMediaRemovesLegacyAsset(t *testing.T) {
+	root := t.TempDir()
+	assetPath := filepath.Join(root, "abc.png")
+	if err := os.WriteFile(assetPath, []byte("png"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &apiConfig{
+		assetsRoot: root,
+		store:      storage.NewMemoryStore("http://localhost:8091/media/"),
+	}
+
+	ref := database.MediaRef{Ref: "http://localhost:8091//assets/abc.png", Kind: database.MediaObject}
+	if err := cfg.deleteMedia(context.Background(), ref); err != nil {
+		t.Fatalf("deleteMedia: %v", err)
+	}
+	if _, err := os.Stat(assetPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("legacy asset still exists: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/imaging"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+// autoThumbnailPrefix holds thumbnails extracted from the video, anything
+// else under thumbnails/ was chosen by the user and is never replaced
+// automatically.
+const autoThumbnailPrefix = "thumbnails/auto/"
+
+// defaultThumbnailWidth is the rendition thumbnail_url points at.
+const defaultThumbnailWidth = 640
+
+// putThumbnail decodes an uploaded or extracted image, stores its resized
+// renditions under prefix and returns the reference to save in
+// thumbnail_url along with the whole rendition set. If storing fails, the
+// renditions already stored are queued for deletion.
+func (cfg *apiConfig) putThumbnail(ctx context.Context, prefix string, data []byte) (string, database.ThumbnailRenditions, error) {
+	img, err := imaging.Decode(data)
+	if err != nil {
+		return "", nil, &processingError{reason: "couldn't read image", err: err}
+	}
+	//re-encoding drops all metadata from the original file
+	renditions, err := imaging.Renditions(img, imaging.DefaultWidths, 85)
+	if err != nil {
+		return "", nil, err
+	}
+
+	//using a crypto/rand.Read and base64.RawURLencoding to create a new base key, e.g. thumbnails/<random key>/640w.jpg
+	key := make([]byte, 32)
+	rand.Read(key)
+	baseKey := prefix + base64.RawURLEncoding.EncodeToString(key)
+
+	stored := database.ThumbnailRenditions{}
+	webp := cfg.thumbnailWebP
+	for _, rendition := range renditions {
+		pathString := fmt.Sprintf("%s/%dw.jpg", baseKey, rendition.Width)
+		err := cfg.store.Put(ctx, pathString, bytes.NewReader(rendition.Data), "image/jpeg")
+		if err != nil {
+			cfg.discardMedia(ctx, thumbnailRefs(stored))
+			return "", nil, fmt.Errorf("failed to store thumbnail: %w", err)
+		}
+		//the urls are bucket,key references, they get presigned when read
+		stored = append(stored, database.ThumbnailRendition{
+			Width:       rendition.Width,
+			Height:      rendition.Height,
+			ContentType: "image/jpeg",
+			URL:         cfg.mediaRef(pathString),
+		})
+
+		if !webp {
+			continue
+		}
+		webpData, err := media.EncodeWebP(ctx, rendition.Data)
+		if err != nil {
+			log.Printf("skipping webp thumbnails: %v", err)
+			webp = false
+			continue
+		}
+		pathString = fmt.Sprintf("%s/%dw.webp", baseKey, rendition.Width)
+		err = cfg.store.Put(ctx, pathString, bytes.NewReader(webpData), "image/webp")
+		if err != nil {
+			cfg.discardMedia(ctx, thumbnailRefs(stored))
+			return "", nil, fmt.Errorf("failed to store thumbnail: %w", err)
+		}
+		stored = append(stored, database.ThumbnailRendition{
+			Width:       rendition.Width,
+			Height:      rendition.Height,
+			ContentType: "image/webp",
+			URL:         cfg.mediaRef(pathString),
+		})
+	}
+
+	//thumbnail_url gets the largest jpeg that still fits a video card
+	defaultRef := stored[0].URL
+	for _, rendition := range stored {
+		if rendition.ContentType == "image/jpeg" && rendition.Width <= defaultThumbnailWidth {
+			defaultRef = rendition.URL
+		}
+	}
+	return defaultRef, stored, nil
+}
+
+// thumbnailRefs lists the stored objects of a rendition set.
+func thumbnailRefs(renditions database.ThumbnailRenditions) []database.MediaRef {
+	return database.Video{ThumbnailRenditions: renditions}.MediaRefs()
+}
+
+// hasUserThumbnail reports whether the video's thumbnail was set by the user
+// rather than extracted from the video.
+func (cfg *apiConfig) hasUserThumbnail(video database.Video) bool {
+	if video.ThumbnailURL == nil {
+		return false
+	}
+	key, ok := cfg.mediaKey(*video.ThumbnailURL)
+	return !ok || !strings.HasPrefix(key, autoThumbnailPrefix)
+}
+
+// generateThumbnail extracts a frame from the video file at path, at the
+// configured offset or the best frame when none is set, and sets it as the
+// video's thumbnail.
+func (cfg *apiConfig) generateThumbnail(ctx context.Context, video *database.Video, path string, duration float64) error {
+	var frame []byte
+	var err error
+	if cfg.thumbnailOffset > 0 && (duration <= 0 || cfg.thumbnailOffset.Seconds() < duration) {
+		frame, err = media.ExtractFrame(ctx, path, cfg.thumbnailOffset)
+	} else {
+		frame, err = media.ExtractBestFrame(ctx, path, duration)
+	}
+	if err != nil {
+		return err
+	}
+	ref, renditions, err := cfg.putThumbnail(ctx, autoThumbnailPrefix, frame)
+	if err != nil {
+		return err
+	}
+	video.ThumbnailURL = &ref
+	video.ThumbnailRenditions = renditions
+	return nil
+}
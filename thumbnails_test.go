@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// failingStore fails every Put after the first ok ones.
+type failingStore struct {
+	storage.ObjectStore
+	ok int
+}
+
+func (s *failingStore) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	if s.ok == 0 {
+		return errors.New("store is down")
+	}
+	s.ok--
+	return s.ObjectStore.Put(ctx, key, body, contentType)
+}
+
+func TestPutThumbnailDiscardsPartialRenditions(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	cfg.storageBucket = "bucket"
+	cfg.store = &failingStore{ObjectStore: cfg.store, ok: 1}
+	ctx := context.Background()
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 1600, 900))); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := cfg.putThumbnail(ctx, "thumbnails/", img.Bytes()); err == nil {
+		t.Fatal("putThumbnail succeeded with a failing store")
+	}
+
+	deletions, err := cfg.db.GetDueStorageDeletions(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deletions) != 1 || !strings.HasPrefix(deletions[0].Ref, "bucket,thumbnails/") {
+		t.Errorf("queued deletions = %+v, want the one rendition that was stored", deletions)
+	}
+}
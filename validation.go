@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validation"
+)
+
+var videoUploadRule = validation.Rule{
+	MediaTypes: []string{validation.MediaTypeMP4},
+	MaxSize:    maxVideoUploadSize,
+	MaxWidth:   7680,
+	MaxHeight:  7680,
+}
+
+var thumbnailUploadRule = validation.Rule{
+	MediaTypes: []string{validation.MediaTypePNG, validation.MediaTypeJPEG},
+	MaxSize:    maxThumbnailSize,
+	MinWidth:   16,
+	MinHeight:  16,
+	MaxWidth:   8192,
+	MaxHeight:  8192,
+}
+
+// respondWithValidationError sends a rejected upload's structured error and
+// reports whether err was one.
+func respondWithValidationError(w http.ResponseWriter, err error) bool {
+	var validationErr *validation.Error
+	if !errors.As(err, &validationErr) {
+		return false
+	}
+	log.Printf("Rejected upload: %s (%s)", validationErr.Message, validationErr.Code)
+	respondWithJSON(w, validationErr.Status, validationErr)
+	return true
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/progress"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validation"
+	"github.com/google/uuid"
+)
+
+// maxVideoUploadSize is the largest video accepted by any upload endpoint.
+const maxVideoUploadSize = 1 << 30
+
+// processingError marks failures caused by the uploaded file itself, which
+// handlers report as 422 instead of a server error.
+type processingError struct {
+	reason string
+	err    error
+}
+
+func (e *processingError) Error() string {
+	return fmt.Sprintf("%s: %v", e.reason, e.err)
+}
+
+func (e *processingError) Unwrap() error {
+	return e.err
+}
+
+// storeVideoFile moves an uploading video to processing, processes the file
+// at path and marks the video ready, or failed with the reason processing
+// stopped. declaredType is the Content-Type the client sent, if any.
+func (cfg *apiConfig) storeVideoFile(ctx context.Context, video database.Video, path, declaredType string) (database.Video, error) {
+	video, err := cfg.db.TransitionVideoStatus(ctx, video.ID, database.VideoStatusProcessing, "")
+	if err != nil {
+		return database.Video{}, err
+	}
+
+	processed, err := cfg.processVideoFile(ctx, video, path, declaredType)
+	if err == nil {
+		processed, err = cfg.markVideoReady(ctx, video, processed)
+	}
+	if err != nil {
+		cfg.failVideo(ctx, video.ID, err)
+		return database.Video{}, err
+	}
+	return processed, nil
+}
+
+// markVideoReady saves processed, the result of processing video, moves it
+// to ready and queues its hls transcode in one transaction, so a ready
+// video always has a transcode on the way. If that fails, the media
+// processing stored is queued for deletion.
+func (cfg *apiConfig) markVideoReady(ctx context.Context, video, processed database.Video) (database.Video, error) {
+	var ready database.Video
+	err := cfg.db.WithTx(ctx, func(tx database.Client) error {
+		//the file's fields are set on the latest version so metadata edited while processing stays
+		_, err := tx.ModifyVideo(ctx, processed.ID, func(video *database.Video) error {
+			cfg.applyProcessedFile(video, processed)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't update video url: %w", err)
+		}
+		ready, err = tx.TransitionVideoStatus(ctx, processed.ID, database.VideoStatusReady, "")
+		if err != nil {
+			return err
+		}
+		//transcoding to hls happens in the background once this commits
+		return enqueueTranscode(ctx, tx, ready)
+	})
+	if err != nil {
+		cfg.discardMedia(ctx, addedMedia(video, processed))
+		return database.Video{}, err
+	}
+	cfg.progress.Publish(ready.ID, progress.Event{Stage: progress.StageReady})
+	return ready, nil
+}
+
+// applyProcessedFile copies the fields processing sets from processed onto
+// video, keeping a thumbnail the user picked in the meantime.
+func (cfg *apiConfig) applyProcessedFile(video *database.Video, processed database.Video) {
+	video.VideoURL = processed.VideoURL
+	video.Width = processed.Width
+	video.Height = processed.Height
+	video.Duration = processed.Duration
+	video.Codec = processed.Codec
+	video.HLSURL = processed.HLSURL
+	if !cfg.hasUserThumbnail(*video) {
+		video.ThumbnailURL = processed.ThumbnailURL
+		video.ThumbnailRenditions = processed.ThumbnailRenditions
+	}
+}
+
+// processVideoFile validates, probes and remuxes the mp4 at path, uploads it
+// to the object store and points the video's metadata at it. The caller
+// saves the returned video.
+func (cfg *apiConfig) processVideoFile(ctx context.Context, video database.Video, path, declaredType string) (database.Video, error) {
+	videoInfo, err := cfg.checkVideoFile(ctx, video.ID, path, declaredType)
+	if err != nil {
+		return database.Video{}, err
+	}
+
+	//remuxing into a second temp file with the moov atom at the front
+	cfg.publishStep(video.ID, "remuxing")
+	processedPath, err := media.FastStart(ctx, path)
+	if errors.Is(err, media.ErrFFmpegUnavailable) {
+		log.Printf("uploading video %s without fast-start: %v", video.ID, err)
+		processedPath = path
+	} else if err != nil {
+		return database.Video{}, &processingError{reason: "couldn't process video", err: err}
+	}
+	if processedPath != path {
+		defer os.Remove(processedPath)
+	}
+
+	processedFile, err := os.Open(processedPath)
+	if err != nil {
+		return database.Video{}, fmt.Errorf("couldn't open processed video: %w", err)
+	}
+	defer processedFile.Close()
+	stat, err := processedFile.Stat()
+	if err != nil {
+		return database.Video{}, fmt.Errorf("couldn't stat processed video: %w", err)
+	}
+
+	//putting the object into the store, the key is prefixed with the orientation, e.g. landscape/<random>.mp4
+	key := make([]byte, 32)
+	rand.Read(key)
+	pathString := videoInfo.Orientation() + "/" + base64.RawURLEncoding.EncodeToString(key) + ".mp4"
+
+	stored := progress.NewReader(processedFile, func(n int64) {
+		cfg.progress.Publish(video.ID, progress.Event{Stage: progress.StageStoring, Done: n, Total: stat.Size()})
+	})
+	err = cfg.store.Put(ctx, pathString, stored, "video/mp4")
+	if err != nil {
+		return database.Video{}, fmt.Errorf("couldn't upload to object store: %w", err)
+	}
+
+	//filling in a thumbnail from the video unless the user picked one
+	if !cfg.hasUserThumbnail(video) {
+		cfg.publishStep(video.ID, "thumbnail")
+		err = cfg.generateThumbnail(ctx, &video, path, videoInfo.Duration)
+		if err != nil {
+			log.Printf("couldn't generate thumbnail for video %s: %v", video.ID, err)
+		}
+	}
+
+	//updating video url in database to a bucket,key reference, it gets presigned when read
+	setVideoFile(&video, cfg.mediaRef(pathString), videoInfo)
+	return video, nil
+}
+
+// checkVideoFile validates the video file at path against videoUploadRule
+// and probes it.
+func (cfg *apiConfig) checkVideoFile(ctx context.Context, videoID uuid.UUID, path, declaredType string) (media.VideoInfo, error) {
+	//checking the file's actual content rather than trusting the declared type
+	cfg.publishStep(videoID, "validating")
+	err := validateFile(videoUploadRule, path, declaredType)
+	if err != nil {
+		return media.VideoInfo{}, err
+	}
+
+	//probing the file with ffprobe to get the dimensions, duration and codec
+	cfg.publishStep(videoID, "probing")
+	videoInfo, err := media.Probe(ctx, path)
+	if err != nil {
+		return media.VideoInfo{}, &processingError{reason: "couldn't read video metadata", err: err}
+	}
+	err = videoUploadRule.CheckDimensions(videoInfo.Width, videoInfo.Height)
+	if err != nil {
+		return media.VideoInfo{}, err
+	}
+	return videoInfo, nil
+}
+
+// setVideoFile points the video at a stored file and its probed metadata.
+func setVideoFile(video *database.Video, videoRef string, videoInfo media.VideoInfo) {
+	video.VideoURL = &videoRef
+	video.Width = &videoInfo.Width
+	video.Height = &videoInfo.Height
+	video.Duration = &videoInfo.Duration
+	video.Codec = &videoInfo.Codec
+	//the hls stream of a previous file doesn't match anymore
+	video.HLSURL = nil
+}
+
+// transitionVideo moves the video to status. If its current status doesn't
+// allow that it responds with 409 and returns false.
+func (cfg *apiConfig) transitionVideo(w http.ResponseWriter, r *http.Request, video *database.Video, status database.VideoStatus) bool {
+	updated, err := cfg.db.TransitionVideoStatus(r.Context(), video.ID, status, "")
+	if errors.Is(err, database.ErrInvalidVideoTransition) {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("Video is %s", updated.Status), err)
+		return false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video status", err)
+		return false
+	}
+	*video = updated
+	if status == database.VideoStatusUploading {
+		//watchers shouldn't keep seeing the outcome of the previous upload
+		cfg.progress.Publish(video.ID, progress.Event{Stage: progress.StageReceiving})
+	}
+	return true
+}
+
+// failVideo marks a processing video failed, keeping a reason the user can
+// act on. It runs even if ctx was cancelled by the client going away.
+func (cfg *apiConfig) failVideo(ctx context.Context, id uuid.UUID, cause error) {
+	reason := "couldn't store video"
+	var validationErr *validation.Error
+	var procErr *processingError
+	if errors.As(cause, &validationErr) {
+		reason = validationErr.Message
+	} else if errors.As(cause, &procErr) {
+		reason = procErr.Error()
+	}
+	_, err := cfg.db.TransitionVideoStatus(context.WithoutCancel(ctx), id, database.VideoStatusFailed, reason)
+	if err != nil {
+		log.Printf("couldn't mark video %s failed: %v", id, err)
+	}
+	cfg.progress.Publish(id, progress.Event{Stage: progress.StageFailed, Error: reason})
+}
+
+func (cfg *apiConfig) publishStep(videoID uuid.UUID, step string) {
+	cfg.progress.Publish(videoID, progress.Event{Stage: progress.StageProcessing, Step: step})
+}
+
+// abandonUpload moves a video whose upload was given up on back to draft,
+// or to ready if it still has the file from an earlier upload. Like
+// failVideo it runs even if ctx was cancelled.
+func (cfg *apiConfig) abandonUpload(ctx context.Context, video database.Video) {
+	status := database.VideoStatusDraft
+	if video.VideoURL != nil {
+		status = database.VideoStatusReady
+	}
+	_, err := cfg.db.TransitionVideoStatus(context.WithoutCancel(ctx), video.ID, status, "")
+	if err != nil && !errors.Is(err, database.ErrInvalidVideoTransition) {
+		log.Printf("couldn't reset status of video %s: %v", video.ID, err)
+	}
+}
+
+func validateFile(rule validation.Rule, path, declaredType string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	_, err = rule.Validate(f, stat.Size(), declaredType)
+	return err
+}
+
+// respondWithVideoProcessingError maps an error from storeVideoFile to a response.
+func respondWithVideoProcessingError(w http.ResponseWriter, err error) {
+	if respondWithValidationError(w, err) {
+		return
+	}
+	var procErr *processingError
+	if errors.As(err, &procErr) {
+		respondWithError(w, http.StatusUnprocessableEntity, procErr.Error(), err)
+		return
+	}
+	if errors.Is(err, database.ErrInvalidVideoTransition) {
+		respondWithError(w, http.StatusConflict, "Video isn't waiting for an upload", err)
+		return
+	}
+	respondWithError(w, http.StatusInternalServerError, "Couldn't store video", err)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestMarkVideoReadyDiscardsUnsavedMedia(t *testing.T) {
+	cfg, user := newTestConfig(t)
+	ctx := context.Background()
+	video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "ready", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the user's own thumbnail stays, it isn't part of the failed upload
+	userThumbnail := cfg.mediaRef("thumbnails/mine.png")
+	video, err = cfg.db.ModifyVideo(ctx, video.ID, func(v *database.Video) error {
+		v.ThumbnailURL = &userThumbnail
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []database.VideoStatus{database.VideoStatusUploading, database.VideoStatusProcessing} {
+		if video, err = cfg.db.TransitionVideoStatus(ctx, video.ID, status, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	processed := video
+	videoRef := cfg.mediaRef("landscape/new.mp4")
+	processed.VideoURL = &videoRef
+	//trashed while processing, so saving the result fails
+	if err := cfg.db.TrashVideo(ctx, video.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.markVideoReady(ctx, video, processed); err == nil {
+		t.Fatal("marked a trashed video ready")
+	}
+
+	deletions, err := cfg.db.GetDueStorageDeletions(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued := []string{}
+	for _, deletion := range deletions {
+		queued = append(queued, deletion.Ref)
+	}
+	if !slices.Equal(queued, []string{videoRef}) {
+		t.Errorf("queued %v for deletion, want only the new video file", queued)
+	}
+}
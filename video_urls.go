@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// mediaRef is what gets stored in video_url/thumbnail_url: "<bucket>,<key>".
+// It is turned into a real URL only when the video is read.
+func (cfg *apiConfig) mediaRef(key string) string {
+	return cfg.storageBucket + "," + key
+}
+
+// mediaKey returns the object key for a stored media reference. Rows written
+// before references were introduced hold a full URL, those resolve to a key
+// when the URL points into the current store.
+func (cfg *apiConfig) mediaKey(ref string) (string, bool) {
+	if strings.Contains(ref, "://") {
+		base := cfg.store.URL("")
+		if strings.HasPrefix(ref, base) {
+			return strings.TrimPrefix(ref, base), true
+		}
+		return "", false
+	}
+	_, key, found := strings.Cut(ref, ",")
+	if !found || key == "" {
+		return "", false
+	}
+	return key, true
+}
+
+func (cfg *apiConfig) resolveMediaURL(ctx context.Context, ref string) (string, error) {
+	key, ok := cfg.mediaKey(ref)
+	if !ok {
+		//legacy url outside of the store, hand it out as is
+		return ref, nil
+	}
+	if cfg.cdn != nil {
+		return cfg.cdn.URL(key)
+	}
+	if presigner, ok := cfg.store.(storage.Presigner); ok {
+		return presigner.PresignGet(ctx, key, cfg.presignExpiry)
+	}
+	return cfg.store.URL(key), nil
+}
+
+// dbVideoToSignedVideo replaces the stored media references on a video with
+// URLs the client can use right now.
+func (cfg *apiConfig) dbVideoToSignedVideo(ctx context.Context, video database.Video) (database.Video, error) {
+	if video.VideoURL != nil {
+		url, err := cfg.resolveMediaURL(ctx, *video.VideoURL)
+		if err != nil {
+			return database.Video{}, err
+		}
+		video.VideoURL = &url
+	}
+	if video.ThumbnailURL != nil {
+		url, err := cfg.resolveMediaURL(ctx, *video.ThumbnailURL)
+		if err != nil {
+			return database.Video{}, err
+		}
+		video.ThumbnailURL = &url
+	}
+	if video.HLSURL != nil {
+		url, err := cfg.resolveHLSURL(ctx, video)
+		if err != nil {
+			return database.Video{}, err
+		}
+		video.HLSURL = &url
+	}
+	renditions := make(database.ThumbnailRenditions, 0, len(video.ThumbnailRenditions))
+	for _, rendition := range video.ThumbnailRenditions {
+		url, err := cfg.resolveMediaURL(ctx, rendition.URL)
+		if err != nil {
+			return database.Video{}, err
+		}
+		rendition.URL = url
+		renditions = append(renditions, rendition)
+	}
+	video.ThumbnailRenditions = renditions
+	return video, nil
+}
+
+func (cfg *apiConfig) dbVideosToSignedVideos(ctx context.Context, videos []database.Video) ([]database.Video, error) {
+	signed := make([]database.Video, 0, len(videos))
+	for _, video := range videos {
+		v, err := cfg.dbVideoToSignedVideo(ctx, video)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't sign video %s: %w", video.ID, err)
+		}
+		signed = append(signed, v)
+	}
+	return signed, nil
+}